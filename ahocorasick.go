@@ -12,6 +12,9 @@ type findIter struct {
 	haystack            []byte
 	pos                 int
 	matchOnlyWholeWords bool
+	options             SearchOptions
+	found               int
+	truncated           bool
 }
 
 // Iter is an iterator over matches found on the current haystack
@@ -20,30 +23,136 @@ type Iter interface {
 	Next() *Match
 }
 
+// StatsIter is implemented by the iterators AhoCorasick gives, which are returned as Iter.
+// A type assertion gives access to how the search went:
+//
+//	iter := ac.IterByteOptions(haystack, SearchOptions{MaxMatches: 10})
+//	for m := iter.Next(); m != nil; m = iter.Next() {
+//	    ...
+//	}
+//	truncated := iter.(StatsIter).Truncated()
+type StatsIter interface {
+	Iter
+	// PrefilterStats gives the statistics of the prefilter for the search done so far
+	PrefilterStats() PrefilterStats
+	// Truncated reports whether a limit of the SearchOptions stopped the iterator
+	// before the end of the haystack, there may or may not have been more matches
+	Truncated() bool
+}
+
+// make sure the iterators implement StatsIter
+var _ StatsIter = (*findIter)(nil)
+var _ StatsIter = (*overlappingIter)(nil)
+
+// SearchOptions limits the work an iterator does. The zero value of a limit means there is none.
+// MaxMatches is the number of matches after which the iterator stops.
+// MaxBytes is the number of bytes at the start of the haystack in which matches are looked for,
+// a search then looks at no more than MaxBytes+MaxPatternLen()-1 bytes.
+// For overlapping searches, the matches have to end in the first MaxBytes bytes instead
+type SearchOptions struct {
+	MaxMatches int
+	MaxBytes   int
+}
+
+// limit gives the end of the part of the haystack the matches are looked for in,
+// past the end if MaxBytes doesn't leave out any of it
+func (o SearchOptions) limit(haystack []byte) int {
+	if o.MaxBytes > 0 && o.MaxBytes < len(haystack) {
+		return o.MaxBytes
+	}
+	return len(haystack) + 1
+}
+
 // Next gives a pointer to the next match yielded by the iterator or nil, if there is none
 func (f *findIter) Next() *Match {
-	if f.pos > len(f.haystack) {
+	m, ok := f.next()
+	if !ok {
 		return nil
 	}
+	return &m
+}
 
-	result := f.fsm.FindAtNoState(f.prestate, f.haystack, f.pos)
-
-	if result == nil {
-		return nil
+// next gives the next match by value, so it doesn't have to be allocated
+func (f *findIter) next() (Match, bool) {
+	if f.options.MaxMatches > 0 && f.found >= f.options.MaxMatches {
+		// looking for another match could take as long as the whole search, the limit is there to avoid that
+		f.truncated = f.truncated || f.pos <= len(f.haystack)
+		return Match{}, false
 	}
 
-	f.pos = result.end - result.len + 1
-
-	if f.matchOnlyWholeWords {
-		if result.Start()-1 >= 0 && (unicode.IsLetter(rune(f.haystack[result.Start()-1])) || unicode.IsDigit(rune(f.haystack[result.Start()-1]))) {
-			return f.Next()
+	hi := f.options.limit(f.haystack)
+
+	for f.pos <= len(f.haystack) {
+		var result Match
+		var ok bool
+		if hi <= len(f.haystack) {
+			result, ok = findBefore(f.fsm, f.prestate, f.haystack, f.pos, hi)
+			if !ok || result.Start() >= hi {
+				f.truncated = true
+				break
+			}
+		} else {
+			result, ok = f.fsm.FindAtNoState(f.prestate, f.haystack, f.pos)
+			if !ok {
+				break
+			}
 		}
-		if result.end < len(f.haystack) && (unicode.IsLetter(rune(f.haystack[result.end])) || unicode.IsDigit(rune(f.haystack[result.end]))) {
-			return f.Next()
+
+		f.pos = result.end - result.len + 1
+
+		if f.matchOnlyWholeWords && !isWholeWord(f.haystack, result) {
+			continue
 		}
+		f.found += 1
+		return result, true
+	}
+	return Match{}, false
+}
+
+// Truncated reports whether a limit of the SearchOptions stopped the iterator
+// before the end of the haystack, there may or may not have been more matches
+func (f *findIter) Truncated() bool {
+	return f.truncated
+}
+
+// isWholeWord reports whether the match is not preceded or followed by a letter or a digit
+func isWholeWord(haystack []byte, m Match) bool {
+	if m.Start()-1 >= 0 && isWordByte(haystack[m.Start()-1]) {
+		return false
+	}
+	if m.end < len(haystack) && isWordByte(haystack[m.end]) {
+		return false
 	}
+	return true
+}
+
+func isWordByte(b byte) bool {
+	return unicode.IsLetter(rune(b)) || unicode.IsDigit(rune(b))
+}
+
+// PrefilterStats gives the statistics of the prefilter for the search done so far
+func (f *findIter) PrefilterStats() PrefilterStats {
+	return f.prestate.stats()
+}
 
-	return result
+// reset points the iterator to the start of `haystack`, with a fresh prefilter state.
+// It lets one iterator search many haystacks
+func (f *findIter) reset(ac AhoCorasick, haystack []byte) {
+	*f.prestate = ac.newPrefilterState()
+	f.haystack = haystack
+	f.pos = 0
+	f.found = 0
+	f.truncated = false
+}
+
+func newFindIter(ac AhoCorasick, prestate *prefilterState, haystack []byte) findIter {
+	return findIter{
+		fsm:                 ac.i,
+		prestate:            prestate,
+		haystack:            haystack,
+		pos:                 0,
+		matchOnlyWholeWords: ac.matchOnlyWholeWords,
+	}
 }
 
 type overlappingIter struct {
@@ -54,44 +163,65 @@ type overlappingIter struct {
 	stateID             stateID
 	matchIndex          int
 	matchOnlyWholeWords bool
+	options             SearchOptions
+	found               int
+	truncated           bool
 }
 
+// Next gives a pointer to the next match yielded by the iterator or nil, if there is none
 func (f *overlappingIter) Next() *Match {
-	if f.pos > len(f.haystack) {
+	m, ok := f.next()
+	if !ok {
 		return nil
 	}
+	return &m
+}
 
-	result := f.fsm.OverlappingFindAt(f.prestate, f.haystack, f.pos, &f.stateID, &f.matchIndex)
-
-	if result == nil {
-		return nil
+func (f *overlappingIter) next() (Match, bool) {
+	if f.options.MaxMatches > 0 && f.found >= f.options.MaxMatches {
+		f.truncated = f.truncated || f.pos <= len(f.haystack)
+		return Match{}, false
 	}
 
-	f.pos = result.End()
+	// the overlapping search reports the matches by their end, so it can simply stop at the limit
+	haystack := f.haystack
+	if hi := f.options.limit(f.haystack); hi <= len(f.haystack) {
+		haystack = f.haystack[:hi]
+	}
 
-	if f.matchOnlyWholeWords {
-		if result.Start()-1 >= 0 && (unicode.IsLetter(rune(f.haystack[result.Start()-1])) || unicode.IsDigit(rune(f.haystack[result.Start()-1]))) {
-			return f.Next()
+	for f.pos <= len(haystack) {
+		result, ok := f.fsm.OverlappingFindAt(f.prestate, haystack, f.pos, &f.stateID, &f.matchIndex)
+		if !ok {
+			f.truncated = len(haystack) < len(f.haystack)
+			break
 		}
-		if result.end < len(f.haystack) && (unicode.IsLetter(rune(f.haystack[result.end])) || unicode.IsDigit(rune(f.haystack[result.end]))) {
-			return f.Next()
+
+		f.pos = result.End()
+
+		if f.matchOnlyWholeWords && !isWholeWord(f.haystack, result) {
+			continue
 		}
+		f.found += 1
+		return result, true
 	}
+	return Match{}, false
+}
 
-	return result
+// Truncated reports whether a limit of the SearchOptions stopped the iterator
+// before the end of the haystack, there may or may not have been more matches
+func (f *overlappingIter) Truncated() bool {
+	return f.truncated
 }
 
-func newOverlappingIter(ac AhoCorasick, haystack []byte) overlappingIter {
-	prestate := prefilterState{
-		skips:       0,
-		skipped:     0,
-		maxMatchLen: ac.i.MaxPatternLen(),
-		inert:       false,
-		lastScanAt:  0,
-	}
+// PrefilterStats gives the statistics of the prefilter for the search done so far
+func (f *overlappingIter) PrefilterStats() PrefilterStats {
+	return f.prestate.stats()
+}
+
+func newOverlappingIter(ac AhoCorasick, prestate *prefilterState, haystack []byte) overlappingIter {
 	return overlappingIter{
 		fsm:                 ac.i,
-		prestate:            &prestate,
+		prestate:            prestate,
 		haystack:            haystack,
 		pos:                 0,
 		stateID:             ac.i.StartState(),
@@ -108,6 +238,24 @@ type AhoCorasick struct {
 	i                   imp
 	matchKind           matchKind
 	matchOnlyWholeWords bool
+	prefilterMode       prefilterMode
+	standard            *AhoCorasick
+}
+
+// overlapping gives an automaton of the same patterns, which finds overlapping matches.
+// That is `ac` itself for StandardMatch, the leftmost match kinds need Opts.Overlapping
+func (ac AhoCorasick) overlapping() AhoCorasick {
+	if ac.matchKind == StandardMatch {
+		return ac
+	}
+	if ac.standard == nil {
+		panic("only StandardMatch or Opts.Overlapping allowed for overlapping matches")
+	}
+	return *ac.standard
+}
+
+func (ac AhoCorasick) newPrefilterState() prefilterState {
+	return newPrefilterState(ac.i.MaxPatternLen(), ac.prefilterMode)
 }
 
 func (ac AhoCorasick) PatternCount() int {
@@ -121,21 +269,9 @@ func (ac AhoCorasick) Iter(haystack string) Iter {
 
 // IterByte gives an iterator over the built patterns
 func (ac AhoCorasick) IterByte(haystack []byte) Iter {
-	prestate := &prefilterState{
-		skips:       0,
-		skipped:     0,
-		maxMatchLen: ac.i.MaxPatternLen(),
-		inert:       false,
-		lastScanAt:  0,
-	}
-
-	return &findIter{
-		fsm:                 ac.i,
-		prestate:            prestate,
-		haystack:            haystack,
-		pos:                 0,
-		matchOnlyWholeWords: ac.matchOnlyWholeWords,
-	}
+	prestate := ac.newPrefilterState()
+	i := newFindIter(ac, &prestate, haystack)
+	return &i
 }
 
 // Iter gives an iterator over the built patterns with overlapping matches
@@ -145,13 +281,66 @@ func (ac AhoCorasick) IterOverlapping(haystack string) Iter {
 
 // IterOverlappingByte gives an iterator over the built patterns with overlapping matches
 func (ac AhoCorasick) IterOverlappingByte(haystack []byte) Iter {
-	if ac.matchKind != StandardMatch {
-		panic("only StandardMatch allowed for overlapping matches")
-	}
-	i := newOverlappingIter(ac, haystack)
+	ac = ac.overlapping()
+	prestate := ac.newPrefilterState()
+	i := newOverlappingIter(ac, &prestate, haystack)
+	return &i
+}
+
+// IterByteOptions gives an iterator over the built patterns, which stops at the limits of `options`
+func (ac AhoCorasick) IterByteOptions(haystack []byte, options SearchOptions) Iter {
+	prestate := ac.newPrefilterState()
+	i := newFindIter(ac, &prestate, haystack)
+	i.options = options
 	return &i
 }
 
+// IterOverlappingByteOptions gives an iterator over the built patterns with overlapping matches, which stops at the limits of `options`
+func (ac AhoCorasick) IterOverlappingByteOptions(haystack []byte, options SearchOptions) Iter {
+	ac = ac.overlapping()
+	prestate := ac.newPrefilterState()
+	i := newOverlappingIter(ac, &prestate, haystack)
+	i.options = options
+	return &i
+}
+
+// MatchIter is an iterator over the matches found on a haystack, like Iter.
+// It gives the matches by value, so no allocation is done per match
+type MatchIter struct {
+	ac       AhoCorasick
+	iter     findIter
+	prestate prefilterState
+}
+
+// IterMatches gives an iterator over the built patterns, which gives the matches by value
+func (ac AhoCorasick) IterMatches(haystack []byte) *MatchIter {
+	m := &MatchIter{ac: ac}
+	m.iter = newFindIter(ac, &m.prestate, nil)
+	m.Reset(haystack)
+	return m
+}
+
+// Next gives the next match yielded by the iterator, ok is false if there is none
+func (m *MatchIter) Next() (match Match, ok bool) {
+	return m.iter.next()
+}
+
+// Reset makes the iterator search `haystack` from the start, so it can be reused without allocating
+func (m *MatchIter) Reset(haystack []byte) {
+	m.iter.reset(m.ac, haystack)
+}
+
+// PrefilterStats gives the statistics of the prefilter for the search done so far
+func (m *MatchIter) PrefilterStats() PrefilterStats {
+	return m.prestate.stats()
+}
+
+var prestatePool = sync.Pool{
+	New: func() interface{} {
+		return new(prefilterState)
+	},
+}
+
 var pool = sync.Pool{
 	New: func() interface{} {
 		return strings.Builder{}
@@ -159,22 +348,47 @@ var pool = sync.Pool{
 }
 
 type Replacer struct {
-	finder Finder
+	finder       Finder
+	policy       ConflictPolicy
+	preserveCase bool
 }
 
 func NewReplacer(finder Finder) Replacer {
 	return Replacer{finder: finder}
 }
 
+// NewReplacerWithPolicy gives a Replacer, which resolves matches that overlap according to `policy`.
+// It panics if the policy needs overlapping matches the finder can't give, see ConflictPolicy
+func NewReplacerWithPolicy(finder Finder, policy ConflictPolicy) Replacer {
+	if ac, ok := automatonOf(finder); ok && policy != ConflictAsFound {
+		ac.overlapping()
+	}
+	return Replacer{finder: finder, policy: policy}
+}
+
 // ReplaceAllFunc replaces the matches found in the haystack according to the user provided function
 // it gives fine grained control over what is replaced.
 // A user can chose to stop the replacing process early by returning false in the lambda
 // In that case, everything from that point will be kept as the original haystack
+// It panics with an *OverlapError, if the policy is ConflictError and matches overlap
 func (r Replacer) ReplaceAllFunc(haystack string, f func(match Match) (string, bool)) string {
-	matches := r.finder.FindAll(haystack)
+	replaced, err := r.ReplaceAllFuncChecked(haystack, f)
+	if err != nil {
+		panic(err)
+	}
+	return replaced
+}
+
+// ReplaceAllFuncChecked is ReplaceAllFunc, which returns an *OverlapError instead of panicking.
+// The haystack is returned unchanged with the error
+func (r Replacer) ReplaceAllFuncChecked(haystack string, f func(match Match) (string, bool)) (string, error) {
+	matches, err := r.replacements(haystack)
+	if err != nil {
+		return haystack, err
+	}
 
 	if len(matches) == 0 {
-		return haystack
+		return haystack, nil
 	}
 
 	replaceWith := make([]string, 0)
@@ -199,7 +413,7 @@ func (r Replacer) ReplaceAllFunc(haystack string, f func(match Match) (string, b
 	for i, match := range matches {
 		if i >= len(replaceWith) {
 			str.WriteString(haystack[start:])
-			return str.String()
+			return str.String(), nil
 		}
 		str.WriteString(haystack[start:match.Start()])
 		str.WriteString(replaceWith[i])
@@ -210,17 +424,40 @@ func (r Replacer) ReplaceAllFunc(haystack string, f func(match Match) (string, b
 		str.WriteString(haystack[start:])
 	}
 
-	return str.String()
+	return str.String(), nil
 }
 
 // ReplaceAll replaces the matches found in the haystack according to the user provided slice `replaceWith`
 // It panics, if `replaceWith` has length different from the patterns that it was built with
 func (r Replacer) ReplaceAll(haystack string, replaceWith []string) string {
+	replaced, err := r.ReplaceAllChecked(haystack, replaceWith)
+	if err != nil {
+		panic(err)
+	}
+	return replaced
+}
+
+// ReplaceAllChecked is ReplaceAll, which returns an *OverlapError instead of panicking, if the policy is ConflictError and matches overlap.
+// It panics, if `replaceWith` has length different from the patterns that it was built with
+func (r Replacer) ReplaceAllChecked(haystack string, replaceWith []string) (string, error) {
 	if len(replaceWith) != r.finder.PatternCount() {
 		panic("replaceWith needs to have the same length as the pattern count")
 	}
 
-	return r.ReplaceAllFunc(haystack, func(match Match) (string, bool) {
+	if r.preserveCase {
+		// the replacements are written into one buffer, instead of a string per match
+		replaceWithBytes := make([][]byte, len(replaceWith))
+		for i, rw := range replaceWith {
+			replaceWithBytes[i] = []byte(rw)
+		}
+		replaced, err := r.AppendReplaceChecked(make([]byte, 0, len(haystack)), []byte(haystack), replaceWithBytes)
+		if err != nil {
+			return haystack, err
+		}
+		return string(replaced), nil
+	}
+
+	return r.ReplaceAllFuncChecked(haystack, func(match Match) (string, bool) {
 		return replaceWith[match.pattern], true
 	})
 }
@@ -232,19 +469,37 @@ type Finder interface {
 
 // FindAll returns the matches found in the haystack
 func (ac AhoCorasick) FindAll(haystack string) []Match {
-	iter := ac.Iter(haystack)
-	matches := make([]Match, 0)
+	return ac.AppendMatches(make([]Match, 0), []byte(haystack))
+}
 
-	for {
-		next := iter.Next()
-		if next == nil {
-			break
-		}
+// FindN returns the first `n` matches found in the haystack, all of them if `n` is not positive.
+// truncated is true if the search stopped after `n` matches before the end of the haystack,
+// there may or may not have been more
+func (ac AhoCorasick) FindN(haystack string, n int) (matches []Match, truncated bool) {
+	prestate := ac.newPrefilterState()
+	iter := newFindIter(ac, &prestate, []byte(haystack))
+	iter.options.MaxMatches = n
 
-		matches = append(matches, *next)
+	matches = make([]Match, 0)
+	for m, ok := iter.next(); ok; m, ok = iter.next() {
+		matches = append(matches, m)
 	}
+	return matches, iter.truncated
+}
+
+// AppendMatches appends the matches found in the haystack to `dst` and gives the extended slice.
+// It doesn't allocate, if `dst` has enough capacity
+func (ac AhoCorasick) AppendMatches(dst []Match, haystack []byte) []Match {
+	prestate := prestatePool.Get().(*prefilterState)
+	defer prestatePool.Put(prestate)
 
-	return matches
+	iter := newFindIter(ac, prestate, nil)
+	iter.reset(ac, haystack)
+
+	for m, ok := iter.next(); ok; m, ok = iter.next() {
+		dst = append(dst, m)
+	}
+	return dst
 }
 
 // AhoCorasickBuilder defines a set of options applied before the patterns are built
@@ -253,6 +508,8 @@ type AhoCorasickBuilder struct {
 	nfaBuilder          *iNFABuilder
 	dfa                 bool
 	matchOnlyWholeWords bool
+	prefilterMode       prefilterMode
+	overlapping         bool
 }
 
 // Opts defines a set of options applied before the patterns are built
@@ -272,20 +529,41 @@ type AhoCorasickBuilder struct {
 // this is due to the fact LeftMostLongestMatch is the matching strategy
 // "testing 123" is found but then is filtered out by MatchOnlyWholeWords
 // use MatchOnlyWholeWords with caution
+//
+// Prefilter overrides the heuristic that decides whether the prefilter is used.
+// The default, PrefilterAuto, stops using it once it stops skipping enough of the haystack.
+//
+// ByteFrequencies ranks every byte by how common it is in the haystacks, 0 being the rarest and 255 the most common.
+// The prefilter looks for the rarest bytes of the patterns. The default ranking is tuned for english text and source code,
+// use LearnByteFrequencies to derive one from a sample of your own haystacks.
+//
+// Overlapping builds a StandardMatch automaton of the patterns next to a leftmost one.
+// The overlapping searches, MatchingPatterns and the conflict policies of NewReplacerWithPolicy need it for the leftmost match kinds.
 type Opts struct {
 	AsciiCaseInsensitive bool
 	MatchOnlyWholeWords  bool
 	MatchKind            matchKind
 	DFA                  bool
+	Prefilter            prefilterMode
+	ByteFrequencies      *[256]byte
+	Overlapping          bool
 }
 
 // NewAhoCorasickBuilder creates a new AhoCorasickBuilder based on Opts
 func NewAhoCorasickBuilder(o Opts) AhoCorasickBuilder {
+	nfaBuilder := newNFABuilder(o.MatchKind, o.AsciiCaseInsensitive)
+	nfaBuilder.prefilter = o.Prefilter != PrefilterNever
+	if o.ByteFrequencies != nil {
+		nfaBuilder.byteFrequencies = o.ByteFrequencies
+	}
+
 	return AhoCorasickBuilder{
 		dfaBuilder:          newDFABuilder(),
-		nfaBuilder:          newNFABuilder(o.MatchKind, o.AsciiCaseInsensitive),
+		nfaBuilder:          nfaBuilder,
 		dfa:                 o.DFA,
 		matchOnlyWholeWords: o.MatchOnlyWholeWords,
+		prefilterMode:       o.Prefilter,
+		overlapping:         o.Overlapping,
 	}
 }
 
@@ -304,12 +582,31 @@ func (a *AhoCorasickBuilder) BuildByte(patterns [][]byte) AhoCorasick {
 	nfa := a.nfaBuilder.build(patterns)
 	match_kind := nfa.matchKind
 
+	var i imp = nfa
 	if a.dfa {
-		dfa := a.dfaBuilder.build(nfa)
-		return AhoCorasick{dfa, match_kind, a.matchOnlyWholeWords}
+		i = a.dfaBuilder.build(nfa)
+	}
+
+	// Rabin-Karp replaces the automaton only when neither it nor the prefilter was asked for
+	if !a.dfa && a.prefilterMode == PrefilterAuto && useRabinKarp(i, patterns) {
+		i = newRabinKarp(i, patterns, a.nfaBuilder.asciiCaseInsensitive)
+	}
+
+	var standard *AhoCorasick
+	if a.overlapping && match_kind != StandardMatch {
+		builder := NewAhoCorasickBuilder(Opts{
+			AsciiCaseInsensitive: a.nfaBuilder.asciiCaseInsensitive,
+			MatchOnlyWholeWords:  a.matchOnlyWholeWords,
+			MatchKind:            StandardMatch,
+			DFA:                  a.dfa,
+			Prefilter:            a.prefilterMode,
+			ByteFrequencies:      a.nfaBuilder.byteFrequencies,
+		})
+		ac := builder.BuildByte(patterns)
+		standard = &ac
 	}
 
-	return AhoCorasick{nfa, match_kind, a.matchOnlyWholeWords}
+	return AhoCorasick{i, match_kind, a.matchOnlyWholeWords, a.prefilterMode, standard}
 }
 
 type imp interface {
@@ -319,9 +616,9 @@ type imp interface {
 	PatternCount() int
 	Prefilter() prefilter
 	UsePrefilter() bool
-	OverlappingFindAt(prestate *prefilterState, haystack []byte, at int, state_id *stateID, match_index *int) *Match
-	EarliestFindAt(prestate *prefilterState, haystack []byte, at int, state_id *stateID) *Match
-	FindAtNoState(prestate *prefilterState, haystack []byte, at int) *Match
+	OverlappingFindAt(prestate *prefilterState, haystack []byte, at int, state_id *stateID, match_index *int) (Match, bool)
+	EarliestFindAt(prestate *prefilterState, haystack []byte, at int, state_id *stateID) (Match, bool)
+	FindAtNoState(prestate *prefilterState, haystack []byte, at int) (Match, bool)
 }
 
 type matchKind int
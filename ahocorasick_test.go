@@ -1,9 +1,15 @@
 package aho_corasick
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
 	"strings"
 	"sync"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 type benchmarkStdlibCase struct {
@@ -371,6 +377,50 @@ func TestAhoCorasick_IterOverlapping(t *testing.T) {
 	}
 }
 
+func TestRareBytesBuilder_OneBytePerPattern(t *testing.T) {
+	// the bytes get rarer towards the end, only the rarest one of the pattern is needed
+	builder := newRareBytesBuilder(false, &byteFrequencies)
+	builder.add([]byte(" eqZ"))
+
+	if builder.count != 1 || !builder.rareSet.contains('Z') {
+		t.Errorf("expected only Z as rare byte got %v bytes", builder.count)
+	}
+}
+
+func TestAhoCorasick_LeftmostEmptyPattern(t *testing.T) {
+	for _, kind := range []matchKind{LeftMostFirstMatch, LeftMostLongestMatch} {
+		builder := NewAhoCorasickBuilder(Opts{MatchKind: kind})
+		ac := builder.Build([]string{"cb", "b a", ""})
+
+		matches := ac.FindAll("bccb")
+		expected := []Match{{2, 0, 0}, {2, 0, 1}, {0, 2, 4}, {2, 0, 3}, {2, 0, 4}}
+		if len(matches) != len(expected) {
+			t.Fatalf("kind %v expected %v matches got %v", kind, expected, matches)
+		}
+		for i, m := range matches {
+			if m != expected[i] {
+				t.Errorf("kind %v expected %v match got %v", kind, expected[i], m)
+			}
+		}
+	}
+}
+
+func TestAhoCorasick_EmptyPatternPrefilter(t *testing.T) {
+	// a prefilter for "ab" would skip to the "a", past the empty matches before it
+	for _, kind := range []matchKind{StandardMatch, LeftMostFirstMatch, LeftMostLongestMatch} {
+		builder := NewAhoCorasickBuilder(Opts{MatchKind: kind})
+		ac := builder.Build([]string{"", "ab"})
+
+		matches := ac.FindAll("xxab")
+		if len(matches) == 0 || matches[0] != (Match{pattern: 0, len: 0, end: 0}) {
+			t.Errorf("kind %v expected an empty match at 0 got %v", kind, matches)
+		}
+		if ac.i.Prefilter() != nil {
+			t.Errorf("kind %v expected no prefilter", kind)
+		}
+	}
+}
+
 func TestAhoCorasick_LeftmostInsensitiveWholeWord(t *testing.T) {
 	for i, t2 := range leftmostInsensitiveWholeWordTestCases {
 		builders := []AhoCorasickBuilder{NewAhoCorasickBuilder(Opts{
@@ -477,3 +527,1747 @@ func BenchmarkAhoCorasick_LeftmostInsensitiveWholeWord(b *testing.B) {
 		}
 	}
 }
+
+func TestAhoCorasick_PrefilterStartState(t *testing.T) {
+	haystack := strings.Repeat("ac", 500) + "ab"
+
+	for _, kind := range []matchKind{StandardMatch, LeftMostFirstMatch, LeftMostLongestMatch} {
+		builder := NewAhoCorasickBuilder(Opts{
+			MatchKind: kind,
+			Prefilter: PrefilterAlways,
+		})
+		ac := builder.Build([]string{"ab"})
+		iter := ac.Iter(haystack)
+
+		matches := 0
+		for next := iter.Next(); next != nil; next = iter.Next() {
+			matches += 1
+		}
+		// every "a" is a candidate, the search must only skip ahead from the start state
+		if stats := iter.(StatsIter).PrefilterStats(); matches != 1 || stats.Candidates != 501 {
+			t.Errorf("kind %v expected 1 match and 501 candidates got %v and %+v", kind, matches, stats)
+		}
+	}
+}
+
+func TestAhoCorasick_PrefilterStats(t *testing.T) {
+	haystack := strings.Repeat("ac", 500)
+	patterns := []string{"ab"}
+
+	for _, mode := range []prefilterMode{PrefilterAuto, PrefilterAlways, PrefilterNever} {
+		builder := NewAhoCorasickBuilder(Opts{
+			MatchKind: LeftMostLongestMatch,
+			Prefilter: mode,
+		})
+		ac := builder.Build(patterns)
+		iter := ac.Iter(haystack)
+
+		for next := iter.Next(); next != nil; next = iter.Next() {
+			t.Errorf("mode %v unexpected match %v", mode, next)
+		}
+		stats := iter.(StatsIter).PrefilterStats()
+
+		switch mode {
+		case PrefilterAuto:
+			if !stats.Inert || stats.InertAt < 0 {
+				t.Errorf("expected the prefilter to go inert got %+v", stats)
+			}
+		case PrefilterAlways:
+			if stats.Inert || stats.Candidates != 500 {
+				t.Errorf("expected the prefilter to stay active got %+v", stats)
+			}
+		case PrefilterNever:
+			if stats != (PrefilterStats{InertAt: -1}) {
+				t.Errorf("expected no prefilter activity got %+v", stats)
+			}
+		}
+	}
+}
+
+func naiveMemchr2(b1, b2 byte, haystack []byte) int {
+	for i, b := range haystack {
+		if b == b1 || b == b2 {
+			return i
+		}
+	}
+	return noneCandidate
+}
+
+func naiveMemchr3(b1, b2, b3 byte, haystack []byte) int {
+	for i, b := range haystack {
+		if b == b1 || b == b2 || b == b3 {
+			return i
+		}
+	}
+	return noneCandidate
+}
+
+func TestMemchr(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	alphabet := []byte{0x00, 0x01, 0x7f, 0x80, 0x81, 0xfe, 0xff, 'a', 'b'}
+
+	for i := 0; i < 10000; i++ {
+		haystack := make([]byte, r.Intn(40))
+		for j := range haystack {
+			haystack[j] = alphabet[r.Intn(len(alphabet))]
+		}
+		b1, b2, b3 := alphabet[r.Intn(len(alphabet))], alphabet[r.Intn(len(alphabet))], alphabet[r.Intn(len(alphabet))]
+
+		if got, expected := memchr2(b1, b2, haystack), naiveMemchr2(b1, b2, haystack); got != expected {
+			t.Fatalf("memchr2(%q, %q, %q) expected %v got %v", b1, b2, haystack, expected, got)
+		}
+		if got, expected := memchr3(b1, b2, b3, haystack), naiveMemchr3(b1, b2, b3, haystack); got != expected {
+			t.Fatalf("memchr3(%q, %q, %q, %q) expected %v got %v", b1, b2, b3, haystack, expected, got)
+		}
+	}
+}
+
+func BenchmarkMemchr2(b *testing.B) {
+	impls := map[string]func(byte, byte, []byte) int{"naive": naiveMemchr2, "swar": memchr2}
+	haystacks := make([][]byte, len(testCasesReplace))
+	for i, t2 := range testCasesReplace {
+		haystacks[i] = []byte(t2.haystack)
+	}
+
+	for name, memchr2 := range impls {
+		memchr2 := memchr2
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, haystack := range haystacks {
+					for at := 0; at < len(haystack); at++ {
+						c := memchr2('Q', 'Z', haystack[at:])
+						if c == noneCandidate {
+							break
+						}
+						at += c
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMemchr3(b *testing.B) {
+	impls := map[string]func(byte, byte, byte, []byte) int{"naive": naiveMemchr3, "swar": memchr3}
+	haystacks := make([][]byte, len(testCasesReplace))
+	for i, t2 := range testCasesReplace {
+		haystacks[i] = []byte(t2.haystack)
+	}
+
+	for name, memchr3 := range impls {
+		memchr3 := memchr3
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, haystack := range haystacks {
+					for at := 0; at < len(haystack); at++ {
+						c := memchr3('Q', 'Z', 'j', haystack[at:])
+						if c == noneCandidate {
+							break
+						}
+						at += c
+					}
+				}
+			}
+		})
+	}
+}
+
+var teddyPatterns = []string{"Hypertonie", "Epilepsie", "Krampfanfällen", "Leberinsuffizienz", "Zulassungsstatus", "Blutdruck", "Wirkstoffprofil"}
+
+// plainAutomaton builds the patterns without a prefilter or Rabin-Karp, as the reference for the faster searches
+func plainAutomaton(opts Opts, patterns []string) AhoCorasick {
+	opts.Prefilter = PrefilterNever
+	builder := NewAhoCorasickBuilder(opts)
+	return builder.Build(patterns)
+}
+
+func assertMatches(t *testing.T, name string, expected, matches []Match) {
+	t.Helper()
+	if len(matches) != len(expected) {
+		t.Fatalf("%v expected %v matches got %v", name, len(expected), len(matches))
+	}
+	for i, m := range matches {
+		if m != expected[i] {
+			t.Errorf("%v expected %v match got %v", name, expected[i], m)
+		}
+	}
+}
+
+// assertAsAutomaton checks that `ac` finds what a plain automaton built with `opts` finds in testCasesReplace
+func assertAsAutomaton(t *testing.T, ac AhoCorasick, opts Opts, patterns []string) {
+	t.Helper()
+	automaton := plainAutomaton(opts, patterns)
+	for _, t2 := range testCasesReplace {
+		assertMatches(t, fmt.Sprintf("kind %v", opts.MatchKind), automaton.FindAll(t2.haystack), ac.FindAll(t2.haystack))
+	}
+}
+
+// setTeddyVector switches the SSSE3 scan on or off until the test ends
+func setTeddyVector(t *testing.T, vector bool) {
+	old := teddyVector
+	teddyVector = vector
+	t.Cleanup(func() {
+		teddyVector = old
+	})
+}
+
+func TestAhoCorasick_Teddy(t *testing.T) {
+	for _, vector := range []bool{teddyVector, false} {
+		setTeddyVector(t, vector)
+
+		for _, kind := range []matchKind{StandardMatch, LeftMostFirstMatch, LeftMostLongestMatch} {
+			opts := Opts{MatchKind: kind}
+			builder := NewAhoCorasickBuilder(opts)
+			ac := builder.Build(teddyPatterns)
+			if _, ok := ac.i.Prefilter().(*teddy); !ok {
+				t.Fatalf("expected a teddy prefilter got %T", ac.i.Prefilter())
+			}
+			if rk, ok := ac.i.(*rabinKarp); ok {
+				ac.i = rk.imp
+			}
+
+			assertAsAutomaton(t, ac, opts, teddyPatterns)
+		}
+	}
+}
+
+func BenchmarkAhoCorasick_Teddy(b *testing.B) {
+	for _, mode := range []prefilterMode{PrefilterNever, PrefilterAlways} {
+		builder := NewAhoCorasickBuilder(Opts{MatchKind: LeftMostLongestMatch, DFA: true, Prefilter: mode})
+		ac := builder.Build(teddyPatterns)
+
+		b.Run(map[prefilterMode]string{PrefilterNever: "no prefilter", PrefilterAlways: "teddy"}[mode], func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, t2 := range testCasesReplace {
+					_ = ac.FindAll(t2.haystack)
+				}
+			}
+		})
+	}
+}
+
+func TestAhoCorasick_RabinKarp(t *testing.T) {
+	setTeddyVector(t, false)
+
+	for _, kind := range []matchKind{StandardMatch, LeftMostFirstMatch, LeftMostLongestMatch} {
+		opts := Opts{AsciiCaseInsensitive: true, MatchKind: kind}
+		builder := NewAhoCorasickBuilder(opts)
+		ac := builder.Build(teddyPatterns)
+		if _, ok := ac.i.(*rabinKarp); !ok {
+			t.Fatalf("expected rabin-karp got %T", ac.i)
+		}
+
+		assertAsAutomaton(t, ac, opts, teddyPatterns)
+
+		for _, opts := range []Opts{{MatchKind: kind, DFA: true}, {MatchKind: kind, Prefilter: PrefilterNever}, {MatchKind: kind, Prefilter: PrefilterAlways}} {
+			builder := NewAhoCorasickBuilder(opts)
+			if ac := builder.Build(teddyPatterns); isRabinKarp(ac) {
+				t.Errorf("options %+v expected the automaton got rabin-karp", opts)
+			}
+		}
+	}
+
+	for _, patterns := range [][]string{{"a", "abcd"}, {"ab", strings.Repeat("b", rabinKarpMaxPatternLen+1)}} {
+		bytePatterns := [][]byte{[]byte(patterns[0]), []byte(patterns[1])}
+		if useRabinKarp(plainAutomaton(Opts{}, patterns).i, bytePatterns) {
+			t.Errorf("patterns %q expected the automaton got rabin-karp", patterns)
+		}
+	}
+}
+
+func isRabinKarp(ac AhoCorasick) bool {
+	_, ok := ac.i.(*rabinKarp)
+	return ok
+}
+
+func TestRabinKarp_SameAsAutomaton(t *testing.T) {
+	patternSets := [][]string{
+		{"abcd", "bc"},
+		{"bc", "abcd"},
+		{"abcd", "bcd", "cd", "abc"},
+		{"ab", "ab", "abc", "abc"},
+	}
+	haystacks := []string{"xabcdx", "abcabcdbcd", "ababcabc", "bcbcd", ""}
+
+	for _, kind := range []matchKind{StandardMatch, LeftMostFirstMatch, LeftMostLongestMatch} {
+		for _, patterns := range patternSets {
+			automaton := plainAutomaton(Opts{MatchKind: kind}, patterns)
+			rk := automaton
+			bytePatterns := make([][]byte, len(patterns))
+			for i, p := range patterns {
+				bytePatterns[i] = []byte(p)
+			}
+			rk.i = newRabinKarp(automaton.i, bytePatterns, false)
+
+			for _, haystack := range haystacks {
+				name := fmt.Sprintf("kind %v patterns %q haystack %q", kind, patterns, haystack)
+				assertMatches(t, name, automaton.FindAll(haystack), rk.FindAll(haystack))
+			}
+		}
+	}
+}
+
+func BenchmarkAhoCorasick_RabinKarp(b *testing.B) {
+	vector := teddyVector
+	teddyVector = false
+	b.Cleanup(func() {
+		teddyVector = vector
+	})
+
+	builder := NewAhoCorasickBuilder(Opts{
+		AsciiCaseInsensitive: true,
+		MatchKind:            LeftMostLongestMatch,
+	})
+	ac := builder.Build(teddyPatterns)
+	automaton := ac
+	automaton.i = ac.i.(*rabinKarp).imp
+
+	for name, ac := range map[string]AhoCorasick{"automaton": automaton, "rabin-karp": ac} {
+		ac := ac
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, t2 := range testCasesReplace {
+					_ = ac.FindAll(t2.haystack)
+				}
+			}
+		})
+	}
+}
+
+func naiveMemchr3Fold(b1, b2, b3 byte, haystack []byte) int {
+	for i, b := range haystack {
+		if b = asciiFold(b); b == b1 || b == b2 || b == b3 {
+			return i
+		}
+	}
+	return noneCandidate
+}
+
+func TestMemchrFold(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	alphabet := []byte{0x00, 0x01, 'A', 'a', 'Z', 'z', '@', '`', '[', '{', 0xc1, 0xe1}
+	needles := []byte{'a', 'z', '@', '`', '{', 0xe1}
+
+	for i := 0; i < 10000; i++ {
+		haystack := make([]byte, r.Intn(40))
+		for j := range haystack {
+			haystack[j] = alphabet[r.Intn(len(alphabet))]
+		}
+		b1, b2, b3 := needles[r.Intn(len(needles))], needles[r.Intn(len(needles))], needles[r.Intn(len(needles))]
+
+		if got, expected := memchrFold(b1, haystack), naiveMemchr3Fold(b1, b1, b1, haystack); got != expected {
+			t.Fatalf("memchrFold(%q, %q) expected %v got %v", b1, haystack, expected, got)
+		}
+		if got, expected := memchr2Fold(b1, b2, haystack), naiveMemchr3Fold(b1, b2, b2, haystack); got != expected {
+			t.Fatalf("memchr2Fold(%q, %q, %q) expected %v got %v", b1, b2, haystack, expected, got)
+		}
+		if got, expected := memchr3Fold(b1, b2, b3, haystack), naiveMemchr3Fold(b1, b2, b3, haystack); got != expected {
+			t.Fatalf("memchr3Fold(%q, %q, %q, %q) expected %v got %v", b1, b2, b3, haystack, expected, got)
+		}
+	}
+}
+
+func TestAhoCorasick_CaseInsensitivePrefilter(t *testing.T) {
+	for _, vector := range []bool{teddyVector, false} {
+		setTeddyVector(t, vector)
+
+		for _, patterns := range [][]string{{"bear", "masha"}, teddyPatterns} {
+			for _, kind := range []matchKind{StandardMatch, LeftMostFirstMatch, LeftMostLongestMatch} {
+				opts := Opts{AsciiCaseInsensitive: true, MatchKind: kind, Prefilter: PrefilterAlways}
+				builder := NewAhoCorasickBuilder(opts)
+				ac := builder.Build(patterns)
+				if ac.i.Prefilter() == nil {
+					t.Fatalf("kind %v expected a prefilter", kind)
+				}
+
+				assertAsAutomaton(t, ac, opts, patterns)
+			}
+		}
+	}
+}
+
+func BenchmarkAhoCorasick_CaseInsensitive(b *testing.B) {
+	patternSets := map[string][]string{
+		"two":   {"bear", "masha"},
+		"teddy": teddyPatterns,
+	}
+
+	for name, patterns := range patternSets {
+		for _, insensitive := range []bool{false, true} {
+			builder := NewAhoCorasickBuilder(Opts{
+				AsciiCaseInsensitive: insensitive,
+				MatchKind:            LeftMostLongestMatch,
+				DFA:                  true,
+			})
+			ac := builder.Build(patterns)
+
+			b.Run(name+map[bool]string{false: "/sensitive", true: "/insensitive"}[insensitive], func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					for _, t2 := range testCasesReplace {
+						_ = ac.FindAll(t2.haystack)
+					}
+				}
+			})
+		}
+	}
+}
+
+// byteSetPatterns are more patterns than teddy takes, starting with more bytes than memchr takes
+func byteSetPatterns() []string {
+	seen := make(map[string]bool)
+	patterns := make([]string, 0)
+
+	for _, t2 := range testCasesReplace {
+		for _, word := range strings.Fields(t2.haystack) {
+			if len(word) < 4 || word[0] < 'A' || word[0] > 'J' || seen[word] {
+				continue
+			}
+			seen[word] = true
+			patterns = append(patterns, word)
+		}
+	}
+	return patterns
+}
+
+func TestAhoCorasick_ByteSet(t *testing.T) {
+	patterns := byteSetPatterns()
+	if len(patterns) <= teddyMaxPatterns {
+		t.Fatalf("expected more than %v patterns got %v", teddyMaxPatterns, len(patterns))
+	}
+
+	for _, kind := range []matchKind{StandardMatch, LeftMostFirstMatch, LeftMostLongestMatch} {
+		opts := Opts{MatchKind: kind, Prefilter: PrefilterAlways}
+		builder := NewAhoCorasickBuilder(opts)
+		ac := builder.Build(patterns)
+		if _, ok := ac.i.Prefilter().(*startByteSet); !ok {
+			t.Fatalf("expected a start byte set got %T", ac.i.Prefilter())
+		}
+
+		assertAsAutomaton(t, ac, opts, patterns)
+	}
+}
+
+func TestAhoCorasick_ByteSetUTF8(t *testing.T) {
+	// the patterns start with 7 different UTF-8 lead bytes, which are rare in the sample
+	words := []string{"Привет", "ёжик", "日本語", "中文", "한국어", "Ελλάδα", "мир", "東京", "שלום"}
+	var patterns []string
+	for _, w1 := range words {
+		for _, w2 := range words {
+			patterns = append(patterns, w1+" "+w2)
+		}
+	}
+	haystack := strings.Repeat("Привет мир, 日本語 中文 東京 ёжик Ελλάδα שלום 한국어 ", 50)
+
+	frequencies, err := LearnByteFrequencies(strings.NewReader(testCasesReplace[3].haystack))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, kind := range []matchKind{StandardMatch, LeftMostFirstMatch, LeftMostLongestMatch} {
+		opts := Opts{MatchKind: kind, Prefilter: PrefilterAlways, ByteFrequencies: frequencies}
+		builder := NewAhoCorasickBuilder(opts)
+		ac := builder.Build(patterns)
+		if _, ok := ac.i.Prefilter().(*startByteSet); !ok {
+			t.Fatalf("expected a start byte set got %T", ac.i.Prefilter())
+		}
+
+		matches := ac.FindAll(haystack)
+		if len(matches) == 0 {
+			t.Fatalf("kind %v expected matches", kind)
+		}
+		assertMatches(t, fmt.Sprintf("kind %v", kind), plainAutomaton(opts, patterns).FindAll(haystack), matches)
+	}
+}
+
+func BenchmarkAhoCorasick_ByteSet(b *testing.B) {
+	patterns := byteSetPatterns()
+
+	for _, mode := range []prefilterMode{PrefilterNever, PrefilterAlways} {
+		builder := NewAhoCorasickBuilder(Opts{MatchKind: LeftMostLongestMatch, DFA: true, Prefilter: mode})
+		ac := builder.Build(patterns)
+
+		b.Run(map[prefilterMode]string{PrefilterNever: "no prefilter", PrefilterAlways: "byte set"}[mode], func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, t2 := range testCasesReplace {
+					_ = ac.FindAll(t2.haystack)
+				}
+			}
+		})
+	}
+}
+
+func TestLearnByteFrequencies(t *testing.T) {
+	frequencies, err := LearnByteFrequencies(strings.NewReader(testCasesReplace[3].haystack))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if frequencies['\x00'] != 0 {
+		t.Errorf("expected unseen bytes to be ranked 0 got %v", frequencies['\x00'])
+	}
+	if frequencies['e'] <= frequencies['z'] || frequencies['z'] == 0 {
+		t.Errorf("expected `e` to be ranked above `z` got %v and %v", frequencies['e'], frequencies['z'])
+	}
+	if frequencies['e'] != 255 && frequencies[' '] != 255 {
+		t.Errorf("expected the most common byte to be ranked 255")
+	}
+}
+
+// emptyReader never gives any bytes, but doesn't fail either
+type emptyReader struct{}
+
+func (emptyReader) Read([]byte) (int, error) {
+	return 0, nil
+}
+
+func TestLearnByteFrequencies_EmptyReads(t *testing.T) {
+	frequencies, err := LearnByteFrequencies(emptyReader{})
+	if err != io.ErrNoProgress || frequencies != nil {
+		t.Errorf("expected %v got %v, %v", io.ErrNoProgress, frequencies, err)
+	}
+
+	frequencies, err = LearnByteFrequencies(iotest.OneByteReader(strings.NewReader("")))
+	if err != nil || frequencies['a'] != 0 {
+		t.Errorf("expected no error and no ranks got %v, %v", frequencies, err)
+	}
+}
+
+func TestAhoCorasick_ByteFrequencies(t *testing.T) {
+	patterns := []string{"azq", "bzq", "czq", "dzq"}
+	frequencies := byteFrequencies
+	frequencies['q'], frequencies['z'] = 255, 0
+
+	for rare, o := range map[byte]Opts{
+		'q': {MatchKind: LeftMostLongestMatch},
+		'z': {MatchKind: LeftMostLongestMatch, ByteFrequencies: &frequencies},
+	} {
+		builder := NewAhoCorasickBuilder(o)
+		ac := builder.Build(patterns)
+
+		p, ok := ac.i.Prefilter().(*rareBytesOne)
+		if !ok {
+			t.Fatalf("expected a single rare byte prefilter got %T", ac.i.Prefilter())
+		}
+		if p.byte1 != rare {
+			t.Errorf("expected rare byte %q got %q", rare, p.byte1)
+		}
+
+		matches := ac.FindAll("xxczqxxazq")
+		if len(matches) != 2 || matches[0].Pattern() != 2 || matches[1].Pattern() != 0 {
+			t.Errorf("expected the patterns 2 and 0 to match got %v", matches)
+		}
+	}
+}
+
+func TestAhoCorasick_FindAllParallel(t *testing.T) {
+	minChunk := parallelMinChunk
+	parallelMinChunk = 16
+	defer func() {
+		parallelMinChunk = minChunk
+	}()
+
+	patterns := [][]string{
+		{"ab", "abcd", "bc", "b", "cd"},
+		{"", "cb", "b a "},
+		{"Hypertonie", "Blutdruck", "Epilepsie", "die"},
+	}
+	haystacks := []string{"abcdabcabcdbcbcd ab cd bccb  b a ", "cbccabcccbc b a  ab abcd b"}
+	for _, t2 := range testCasesReplace {
+		haystacks = append(haystacks, t2.haystack)
+	}
+
+	for _, kind := range []matchKind{StandardMatch, LeftMostFirstMatch, LeftMostLongestMatch} {
+		for _, wholeWords := range []bool{false, true} {
+			for _, p := range patterns {
+				builder := NewAhoCorasickBuilder(Opts{MatchKind: kind, MatchOnlyWholeWords: wholeWords})
+				ac := builder.Build(p)
+
+				for _, haystack := range haystacks {
+					expected := ac.FindAll(haystack)
+
+					for workers := 1; workers <= 8; workers++ {
+						name := fmt.Sprintf("kind %v patterns %q workers %v", kind, p, workers)
+						assertMatches(t, name, expected, ac.FindAllParallel([]byte(haystack), workers))
+					}
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkAhoCorasick_FindAllParallel(b *testing.B) {
+	builder := NewAhoCorasickBuilder(Opts{MatchKind: LeftMostLongestMatch, DFA: true})
+	ac := builder.Build(teddyPatterns)
+
+	var haystack []byte
+	for len(haystack) < 8<<20 {
+		for _, t2 := range testCasesReplace {
+			haystack = append(haystack, t2.haystack...)
+		}
+	}
+
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("%v workers", workers), func(b *testing.B) {
+			b.SetBytes(int64(len(haystack)))
+			for i := 0; i < b.N; i++ {
+				_ = ac.FindAllParallel(haystack, workers)
+			}
+		})
+	}
+}
+
+func TestAhoCorasick_FindAllBatch(t *testing.T) {
+	var haystacks [][]byte
+	for _, t2 := range testCasesReplace {
+		haystacks = append(haystacks, []byte(t2.haystack), nil, []byte("Hypertonie und Blutdruck"))
+	}
+
+	for _, kind := range []matchKind{StandardMatch, LeftMostFirstMatch, LeftMostLongestMatch} {
+		builder := NewAhoCorasickBuilder(Opts{MatchKind: kind, MatchOnlyWholeWords: true})
+		ac := builder.Build(teddyPatterns)
+
+		expected := make([][]Match, len(haystacks))
+		for i, haystack := range haystacks {
+			expected[i] = ac.FindAll(string(haystack))
+		}
+
+		batch := make([][]Match, len(haystacks))
+		ac.FindAllBatch(haystacks, func(docIdx int, m Match) {
+			batch[docIdx] = append(batch[docIdx], m)
+		})
+
+		var mu sync.Mutex
+		parallel := make([][]Match, len(haystacks))
+		ac.FindAllBatchParallel(haystacks, 3, func(docIdx int, m Match) {
+			mu.Lock()
+			parallel[docIdx] = append(parallel[docIdx], m)
+			mu.Unlock()
+		})
+
+		for _, got := range [][][]Match{batch, parallel} {
+			for i := range haystacks {
+				assertMatches(t, fmt.Sprintf("kind %v haystack %v", kind, i), expected[i], got[i])
+			}
+		}
+	}
+}
+
+func BenchmarkAhoCorasick_FindAllBatch(b *testing.B) {
+	builder := NewAhoCorasickBuilder(Opts{MatchKind: LeftMostLongestMatch, DFA: true})
+	ac := builder.Build([]string{"error", "timeout", "refused"})
+
+	haystacks := make([][]byte, 10000)
+	for i := range haystacks {
+		haystacks[i] = []byte(fmt.Sprintf("2024-01-01 12:00:%02d connection %v refused by peer", i%60, i))
+	}
+
+	b.Run("FindAll", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, haystack := range haystacks {
+				_ = ac.FindAll(string(haystack))
+			}
+		}
+	})
+	b.Run("FindAllBatch", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ac.FindAllBatch(haystacks, func(docIdx int, m Match) {})
+		}
+	})
+}
+
+func TestAhoCorasick_AppendMatches(t *testing.T) {
+	for _, dfa := range []bool{false, true} {
+		builder := NewAhoCorasickBuilder(Opts{MatchKind: LeftMostLongestMatch, MatchOnlyWholeWords: true, DFA: dfa})
+		ac := builder.Build(teddyPatterns)
+		iter := ac.IterMatches(nil)
+
+		for _, t2 := range testCasesReplace {
+			expected := ac.FindAll(t2.haystack)
+			dst := []Match{{pattern: -1}}
+
+			matches := ac.AppendMatches(dst, []byte(t2.haystack))
+			if len(matches) != len(expected)+1 || matches[0] != dst[0] {
+				t.Fatalf("expected %v matches after %v got %v", len(expected), dst[0], matches)
+			}
+
+			iter.Reset([]byte(t2.haystack))
+			i := 0
+			for m, ok := iter.Next(); ok; m, ok = iter.Next() {
+				if i >= len(expected) || m != expected[i] || matches[i+1] != expected[i] {
+					t.Fatalf("expected %v match got %v and %v", expected[i], m, matches[i+1])
+				}
+				i++
+			}
+			if i != len(expected) {
+				t.Errorf("expected %v matches from the iterator got %v", len(expected), i)
+			}
+		}
+	}
+}
+
+func TestAhoCorasick_AppendMatchesAllocs(t *testing.T) {
+	haystack := []byte(testCasesReplace[3].haystack)
+
+	for _, kind := range []matchKind{StandardMatch, LeftMostFirstMatch, LeftMostLongestMatch} {
+		for _, dfa := range []bool{false, true} {
+			builder := NewAhoCorasickBuilder(Opts{MatchKind: kind, DFA: dfa})
+			ac := builder.Build(teddyPatterns)
+			dst := make([]Match, 0, 1024)
+			iter := ac.IterMatches(nil)
+
+			allocs := testing.AllocsPerRun(100, func() {
+				dst = ac.AppendMatches(dst[:0], haystack)
+			})
+			if allocs != 0 || len(dst) == 0 {
+				t.Errorf("kind %v dfa %v expected AppendMatches to find matches without allocating got %v allocations", kind, dfa, allocs)
+			}
+
+			allocs = testing.AllocsPerRun(100, func() {
+				iter.Reset(haystack)
+				for _, ok := iter.Next(); ok; _, ok = iter.Next() {
+				}
+			})
+			if allocs != 0 {
+				t.Errorf("kind %v dfa %v expected MatchIter not to allocate got %v allocations", kind, dfa, allocs)
+			}
+		}
+	}
+}
+
+func BenchmarkAhoCorasick_AppendMatches(b *testing.B) {
+	for _, kind := range []matchKind{StandardMatch, LeftMostLongestMatch} {
+		for _, dfa := range []bool{false, true} {
+			builder := NewAhoCorasickBuilder(Opts{MatchKind: kind, DFA: dfa})
+			ac := builder.Build(teddyPatterns)
+
+			var haystacks [][]byte
+			for _, t2 := range testCasesReplace {
+				haystacks = append(haystacks, []byte(t2.haystack))
+			}
+
+			name := fmt.Sprintf("%v dfa %v", map[matchKind]string{StandardMatch: "standard", LeftMostLongestMatch: "leftmost longest"}[kind], dfa)
+
+			b.Run("AppendMatches "+name, func(b *testing.B) {
+				b.ReportAllocs()
+				dst := make([]Match, 0, 1024)
+				for i := 0; i < b.N; i++ {
+					for _, haystack := range haystacks {
+						dst = ac.AppendMatches(dst[:0], haystack)
+					}
+				}
+			})
+			b.Run("MatchIter "+name, func(b *testing.B) {
+				b.ReportAllocs()
+				iter := ac.IterMatches(nil)
+				for i := 0; i < b.N; i++ {
+					for _, haystack := range haystacks {
+						iter.Reset(haystack)
+						for _, ok := iter.Next(); ok; _, ok = iter.Next() {
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestAhoCorasick_FindAllContext(t *testing.T) {
+	haystack := strings.Repeat("Hypertonie und Blutdruck, ", 20000)
+
+	for _, kind := range []matchKind{StandardMatch, LeftMostFirstMatch, LeftMostLongestMatch} {
+		builder := NewAhoCorasickBuilder(Opts{MatchKind: kind, MatchOnlyWholeWords: true})
+		ac := builder.Build(teddyPatterns)
+		expected := ac.FindAll(haystack)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		matches, err := ac.FindAllContext(ctx, haystack)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertMatches(t, fmt.Sprintf("kind %v", kind), expected, matches)
+
+		cancel()
+		matches, err = ac.FindAllContext(ctx, haystack)
+		if err != context.Canceled || len(matches) != 0 {
+			t.Errorf("kind %v expected no matches and %v got %v, %v", kind, context.Canceled, len(matches), err)
+		}
+
+		ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		matches, err = ac.FindAllContext(ctx, haystack)
+		cancel()
+		if err != context.DeadlineExceeded || len(matches) != 0 {
+			t.Errorf("kind %v expected no matches and %v got %v, %v", kind, context.DeadlineExceeded, len(matches), err)
+		}
+	}
+}
+
+func TestAhoCorasick_IterContext(t *testing.T) {
+	haystack := []byte(strings.Repeat("Hypertonie und Blutdruck, ", 20000))
+
+	for _, kind := range []matchKind{StandardMatch, LeftMostFirstMatch, LeftMostLongestMatch} {
+		builder := NewAhoCorasickBuilder(Opts{MatchKind: kind})
+		ac := builder.Build(teddyPatterns)
+		expected := ac.FindAll(string(haystack))
+
+		// the iterator notices the cancellation at its next check, before another contextCheckMatches matches
+		ctx, cancel := context.WithCancel(context.Background())
+		iter := ac.IterContext(ctx, haystack)
+		var matches []Match
+		for m, ok := iter.Next(); ok; m, ok = iter.Next() {
+			matches = append(matches, m)
+			if len(matches) == 10 {
+				cancel()
+			}
+		}
+		cancel()
+		if iter.Err() != context.Canceled || len(matches) < 10 || len(matches) > 10+contextCheckMatches {
+			t.Fatalf("kind %v expected to stop after 10 of %v matches with %v got %v, %v", kind, len(expected), context.Canceled, len(matches), iter.Err())
+		}
+		assertMatches(t, fmt.Sprintf("kind %v", kind), expected[:len(matches)], matches)
+
+		// once done, the iterator stays stopped
+		iter.Reset(haystack)
+		if _, ok := iter.Next(); ok || iter.Err() != context.Canceled {
+			t.Errorf("kind %v expected no match after a reset got %v", kind, iter.Err())
+		}
+	}
+}
+
+func TestAhoCorasick_FindAllBatchContext(t *testing.T) {
+	haystacks := [][]byte{[]byte("Hypertonie"), []byte("Blutdruck"), []byte("Epilepsie")}
+	builder := NewAhoCorasickBuilder(Opts{MatchKind: LeftMostLongestMatch})
+	ac := builder.Build(teddyPatterns)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var docs []int
+	err := ac.FindAllBatchContext(ctx, haystacks, func(docIdx int, m Match) {
+		docs = append(docs, docIdx)
+		if docIdx == 1 {
+			cancel()
+		}
+	})
+	if err != context.Canceled || len(docs) != 2 {
+		t.Errorf("expected the matches of 2 haystacks and %v got %v, %v", context.Canceled, docs, err)
+	}
+}
+
+func TestAhoCorasick_FindN(t *testing.T) {
+	builder := NewAhoCorasickBuilder(Opts{MatchKind: LeftMostLongestMatch})
+	ac := builder.Build([]string{"ab", "abcd", "cd"})
+	haystack := "abcd ab cd abcd"
+	expected := ac.FindAll(haystack)
+
+	for n := 0; n <= len(expected)+1; n++ {
+		matches, truncated := ac.FindN(haystack, n)
+
+		count := n
+		if n == 0 || n > len(expected) {
+			count = len(expected)
+		}
+		if len(matches) != count || truncated != (n > 0 && n <= len(expected)) {
+			t.Fatalf("n %v expected %v matches got %v, truncated %v", n, count, len(matches), truncated)
+		}
+		for i, m := range matches {
+			if m != expected[i] {
+				t.Errorf("n %v expected %v match got %v", n, expected[i], m)
+			}
+		}
+	}
+}
+
+func TestAhoCorasick_SearchOptions(t *testing.T) {
+	haystack := []byte("abcd ab cd abcd bc")
+
+	for _, kind := range []matchKind{StandardMatch, LeftMostFirstMatch, LeftMostLongestMatch} {
+		builder := NewAhoCorasickBuilder(Opts{MatchKind: kind})
+		ac := builder.Build([]string{"ab", "abcd", "cd", "bc", "d ab"})
+		expected := ac.FindAll(string(haystack))
+
+		for maxBytes := 1; maxBytes <= len(haystack)+1; maxBytes++ {
+			iter := ac.IterByteOptions(haystack, SearchOptions{MaxBytes: maxBytes})
+
+			var matches []Match
+			for next := iter.Next(); next != nil; next = iter.Next() {
+				matches = append(matches, *next)
+			}
+
+			var prefix []Match
+			for _, m := range expected {
+				if m.Start() < maxBytes {
+					prefix = append(prefix, m)
+				}
+			}
+			if len(matches) != len(prefix) || iter.(StatsIter).Truncated() != (maxBytes < len(haystack)) {
+				t.Fatalf("kind %v max bytes %v expected %v got %v, truncated %v", kind, maxBytes, prefix, matches, iter.(StatsIter).Truncated())
+			}
+			for i, m := range matches {
+				if m != prefix[i] {
+					t.Errorf("kind %v max bytes %v expected %v match got %v", kind, maxBytes, prefix[i], m)
+				}
+			}
+		}
+	}
+
+	builder := NewAhoCorasickBuilder(Opts{MatchKind: StandardMatch})
+	ac := builder.Build([]string{"ab", "abcd", "cd", "bc"})
+
+	iter := ac.IterOverlappingByteOptions(haystack, SearchOptions{MaxBytes: 6, MaxMatches: 4})
+	var matches []Match
+	for next := iter.Next(); next != nil; next = iter.Next() {
+		if next.End() > 6 {
+			t.Errorf("expected matches ending before 6 got %v", next)
+		}
+		matches = append(matches, *next)
+	}
+	if len(matches) != 4 || !iter.(StatsIter).Truncated() {
+		t.Errorf("expected 4 matches and a truncated search got %v, %v", matches, iter.(StatsIter).Truncated())
+	}
+}
+
+func TestAhoCorasick_Truncated(t *testing.T) {
+	builder := NewAhoCorasickBuilder(Opts{MatchKind: StandardMatch})
+	ac := builder.Build([]string{"a", "x"})
+	haystack := []byte("axa")
+
+	if matches, truncated := ac.FindN("axa", 4); len(matches) != 3 || truncated {
+		t.Errorf("expected 3 matches and no truncation got %v, %v", matches, truncated)
+	}
+	// the search isn't continued to find out if there would have been another match
+	if matches, truncated := ac.FindN("axa", 3); len(matches) != 3 || !truncated {
+		t.Errorf("expected 3 matches and a truncation got %v, %v", matches, truncated)
+	}
+	if matches, truncated := ac.FindN("ax", 1); len(matches) != 1 || !truncated {
+		t.Errorf("expected 1 match and a truncation got %v, %v", matches, truncated)
+	}
+
+	// a limit that leaves out nothing doesn't truncate the search, whether it's overlapping or not
+	iters := map[string]Iter{
+		"iter":         ac.IterByteOptions(haystack, SearchOptions{MaxBytes: len(haystack)}),
+		"overlapping":  ac.IterOverlappingByteOptions(haystack, SearchOptions{MaxBytes: len(haystack)}),
+		"more matches": ac.IterByteOptions(haystack, SearchOptions{MaxMatches: 4}),
+	}
+	for name, iter := range iters {
+		matches := 0
+		for next := iter.Next(); next != nil; next = iter.Next() {
+			matches += 1
+		}
+		if matches != 3 || iter.(StatsIter).Truncated() {
+			t.Errorf("%v expected 3 matches and no truncation got %v, %v", name, matches, iter.(StatsIter).Truncated())
+		}
+	}
+}
+
+func TestAhoCorasick_TruncatedNoLookAhead(t *testing.T) {
+	builder := NewAhoCorasickBuilder(Opts{MatchKind: StandardMatch})
+	ac := builder.Build([]string{"a"})
+	haystack := []byte("a" + strings.Repeat("x", 1000) + "a")
+
+	iters := map[string]Iter{
+		"iter":        ac.IterByteOptions(haystack, SearchOptions{MaxMatches: 1}),
+		"overlapping": ac.IterOverlappingByteOptions(haystack, SearchOptions{MaxMatches: 1}),
+	}
+	for name, iter := range iters {
+		if iter.Next() == nil {
+			t.Fatalf("%v expected a match", name)
+		}
+		// reaching the limit must not search the rest of the haystack
+		for i := 0; i < 2; i++ {
+			if next := iter.Next(); next != nil || !iter.(StatsIter).Truncated() {
+				t.Errorf("%v expected no match and a truncation got %v", name, next)
+			}
+		}
+		pos := 0
+		switch it := iter.(type) {
+		case *findIter:
+			pos = it.pos
+		case *overlappingIter:
+			pos = it.pos
+		}
+		if pos != 1 {
+			t.Errorf("%v expected the search to stop after the first match got position %v", name, pos)
+		}
+	}
+}
+
+func TestAhoCorasick_Count(t *testing.T) {
+	patterns := []string{"ab", "abcd", "cd", "bc", "d ab"}
+	haystack := []byte("abcd ab cd abcd bc")
+
+	for _, kind := range []matchKind{StandardMatch, LeftMostFirstMatch, LeftMostLongestMatch} {
+		for _, dfa := range []bool{false, true} {
+			builder := NewAhoCorasickBuilder(Opts{MatchKind: kind, DFA: dfa})
+			ac := builder.Build(patterns)
+
+			expected := make([]int, len(patterns))
+			matches := ac.FindAll(string(haystack))
+			for _, m := range matches {
+				expected[m.Pattern()] += 1
+			}
+
+			counts := make([]int, len(patterns))
+			ac.CountByPattern(haystack, counts)
+			if c := ac.Count(haystack); c != len(matches) {
+				t.Errorf("kind %v expected %v matches got %v", kind, len(matches), c)
+			}
+			for i := range counts {
+				if counts[i] != expected[i] {
+					t.Errorf("kind %v expected %v matches of pattern %v got %v", kind, expected[i], i, counts[i])
+				}
+			}
+		}
+	}
+
+	builder := NewAhoCorasickBuilder(Opts{MatchKind: StandardMatch, DFA: true})
+	ac := builder.Build(patterns)
+
+	expected := make([]int, len(patterns))
+	total := 0
+	iter := ac.IterOverlappingByte(haystack)
+	for next := iter.Next(); next != nil; next = iter.Next() {
+		expected[next.Pattern()] += 1
+		total += 1
+	}
+
+	counts := make([]int, len(patterns))
+	ac.CountOverlappingByPattern(haystack, counts)
+	ac.CountOverlappingByPattern(haystack, counts)
+	if c := ac.CountOverlapping(haystack); c != total {
+		t.Errorf("expected %v overlapping matches got %v", total, c)
+	}
+	for i := range counts {
+		if counts[i] != 2*expected[i] {
+			t.Errorf("expected %v overlapping matches of pattern %v got %v", 2*expected[i], i, counts[i])
+		}
+	}
+}
+
+func BenchmarkAhoCorasick_Count(b *testing.B) {
+	builder := NewAhoCorasickBuilder(Opts{MatchKind: StandardMatch, DFA: true})
+	ac := builder.Build(teddyPatterns)
+	counts := make([]int, len(teddyPatterns))
+
+	var haystacks [][]byte
+	for _, t2 := range testCasesReplace {
+		haystacks = append(haystacks, []byte(t2.haystack))
+	}
+
+	b.Run("CountByPattern", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, haystack := range haystacks {
+				ac.CountByPattern(haystack, counts)
+			}
+		}
+	})
+	b.Run("CountOverlappingByPattern", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, haystack := range haystacks {
+				ac.CountOverlappingByPattern(haystack, counts)
+			}
+		}
+	})
+}
+
+func TestAhoCorasick_MatchingPatterns(t *testing.T) {
+	patterns := make([]string, 0, 200)
+	for i := 0; i < 200; i++ {
+		patterns = append(patterns, fmt.Sprintf("<%v>", i))
+	}
+	patterns = append(patterns, "<1", "1>")
+
+	builder := NewAhoCorasickBuilder(Opts{MatchKind: StandardMatch, DFA: true})
+	ac := builder.Build(patterns)
+
+	matching := ac.MatchingPatterns([]byte("xx<1> <150> <1> <70>x <1"))
+	expected := []int{1, 70, 150, 200, 201}
+	if len(matching) != len(expected) {
+		t.Fatalf("expected %v got %v", expected, matching)
+	}
+	for i, p := range matching {
+		if p != expected[i] {
+			t.Errorf("expected %v got %v", expected, matching)
+		}
+	}
+
+	builder = NewAhoCorasickBuilder(Opts{MatchKind: StandardMatch})
+	ac = builder.Build([]string{"a", "ab"})
+
+	if matching := ac.MatchingPatterns([]byte("abxxxxxxxxxxab")); len(matching) != 2 {
+		t.Errorf("expected both patterns got %v", matching)
+	}
+	if matching := ac.MatchingPatterns(nil); len(matching) != 0 {
+		t.Errorf("expected no patterns got %v", matching)
+	}
+
+	// a leftmost search reports "abcd" and "bc", but not "bcd"
+	for _, kind := range []matchKind{LeftMostFirstMatch, LeftMostLongestMatch} {
+		for _, dfa := range []bool{false, true} {
+			builder = NewAhoCorasickBuilder(Opts{MatchKind: kind, DFA: dfa, AsciiCaseInsensitive: true, Overlapping: true})
+			ac = builder.Build([]string{"abcd", "bc", "bcd", "y"})
+
+			if matching := ac.MatchingPatterns([]byte("xABCDx")); len(matching) != 3 || matching[2] != 2 {
+				t.Errorf("kind %v dfa %v expected patterns 0, 1 and 2 got %v", kind, dfa, matching)
+			}
+			if count := ac.CountOverlapping([]byte("xABCDx")); count != 3 {
+				t.Errorf("kind %v dfa %v expected 3 overlapping matches got %v", kind, dfa, count)
+			}
+			if matches := ac.FindAll("xABCDx"); len(matches) == 0 || matches[0] != (Match{pattern: 0, len: 4, end: 5}) {
+				t.Errorf("kind %v dfa %v expected a leftmost match of abcd first got %v", kind, dfa, matches)
+			}
+		}
+	}
+
+	// without Opts.Overlapping there is no automaton for the overlapping matches
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic")
+		}
+	}()
+	builder = NewAhoCorasickBuilder(Opts{MatchKind: LeftMostLongestMatch})
+	ac = builder.Build([]string{"abcd", "bc"})
+	ac.MatchingPatterns([]byte("xabcdx"))
+}
+
+func TestAhoCorasick_ReplaceAllBytes(t *testing.T) {
+	for _, i2 := range testCasesReplace {
+		builder := NewAhoCorasickBuilder(Opts{
+			AsciiCaseInsensitive: true,
+			MatchOnlyWholeWords:  true,
+			MatchKind:            LeftMostLongestMatch,
+		})
+
+		ac := builder.Build(i2.patterns)
+		replaceWith := make([][]byte, len(i2.replaceWith))
+		for i, rw := range i2.replaceWith {
+			replaceWith[i] = []byte(rw)
+		}
+
+		for _, r := range []Replacer{NewReplacer(ac), NewReplacer(&ac)} {
+			replaced := r.ReplaceAllBytes([]byte(i2.haystack), replaceWith)
+			if string(replaced) != i2.replaced {
+				t.Errorf("expected %v got %v", i2.replaced, string(replaced))
+			}
+
+			appended := r.AppendReplace([]byte("prefix "), []byte(i2.haystack), replaceWith)
+			if string(appended) != "prefix "+i2.replaced {
+				t.Errorf("expected %v got %v", "prefix "+i2.replaced, string(appended))
+			}
+		}
+	}
+
+	for _, i2 := range testCasesReplaceN {
+		builder := NewAhoCorasickBuilder(Opts{
+			AsciiCaseInsensitive: true,
+			MatchOnlyWholeWords:  true,
+			MatchKind:            LeftMostLongestMatch,
+			DFA:                  true,
+		})
+
+		ac := builder.Build(i2.patterns)
+		r := NewReplacer(ac)
+		i := -1
+		replaced := r.ReplaceAllFuncBytes([]byte(i2.haystack), func(match Match) ([]byte, bool) {
+			i += 1
+			return []byte(i2.replaceWith[match.pattern]), i2.stopAt != i
+		})
+		if string(replaced) != i2.replaced {
+			t.Errorf("expected `%v` got `%v`", i2.replaced, string(replaced))
+		}
+	}
+}
+
+func TestAhoCorasick_ReplaceAllBytesNested(t *testing.T) {
+	for kind, expected := range map[matchKind]string{
+		StandardMatch:        "xa2dx a2d",
+		LeftMostFirstMatch:   "x1x 1",
+		LeftMostLongestMatch: "x1x 1",
+	} {
+		builder := NewAhoCorasickBuilder(Opts{MatchKind: kind})
+		ac := builder.Build([]string{"abcd", "bc"})
+		r := NewReplacer(ac)
+
+		replaced := r.ReplaceAllBytes([]byte("xabcdx abcd"), [][]byte{[]byte("1"), []byte("2")})
+		if string(replaced) != expected {
+			t.Errorf("kind %v expected %v got %v", kind, expected, string(replaced))
+		}
+	}
+}
+
+func BenchmarkAhoCorasick_AppendReplace(b *testing.B) {
+	replaceWith := make([][][]byte, len(testCasesReplace))
+	for i, t2 := range testCasesReplace {
+		for _, rw := range t2.replaceWith {
+			replaceWith[i] = append(replaceWith[i], []byte(rw))
+		}
+	}
+
+	b.ReportAllocs()
+	var dst []byte
+	for i := 0; i < b.N; i++ {
+		for i, r := range acsNFA {
+			dst = r.AppendReplace(dst[:0], []byte(testCasesReplace[i].haystack), replaceWith[i])
+		}
+	}
+}
+
+func TestReplacer_ConflictPolicy(t *testing.T) {
+	expected := map[ConflictPolicy]string{
+		ConflictLeftmostLongest: "x1x 1",
+		ConflictFirstWins:       "xa2dx a2d",
+	}
+	asFound := map[matchKind]string{
+		StandardMatch:        "xa2dx a2d",
+		LeftMostFirstMatch:   "x1x 1",
+		LeftMostLongestMatch: "x1x 1",
+	}
+
+	for _, kind := range []matchKind{StandardMatch, LeftMostFirstMatch, LeftMostLongestMatch} {
+		expected[ConflictAsFound] = asFound[kind]
+
+		for policy, replaced := range expected {
+			for _, dfa := range []bool{false, true} {
+				builder := NewAhoCorasickBuilder(Opts{MatchKind: kind, DFA: dfa, Overlapping: true})
+				ac := builder.Build([]string{"abcd", "bc"})
+				r := NewReplacerWithPolicy(ac, policy)
+
+				got, err := r.ReplaceAllChecked("xabcdx abcd", []string{"1", "2"})
+				if err != nil || got != replaced {
+					t.Errorf("policy %v kind %v expected %v got %v %v", policy, kind, replaced, got, err)
+				}
+				gotBytes := r.ReplaceAllBytes([]byte("xabcdx abcd"), [][]byte{[]byte("1"), []byte("2")})
+				if string(gotBytes) != replaced {
+					t.Errorf("policy %v kind %v expected %v got %v", policy, kind, replaced, string(gotBytes))
+				}
+			}
+		}
+	}
+
+	for _, kind := range []matchKind{StandardMatch, LeftMostFirstMatch, LeftMostLongestMatch} {
+		builder := NewAhoCorasickBuilder(Opts{MatchKind: kind, Overlapping: true})
+		ac := builder.Build([]string{"abcd", "bc", "x"})
+		r := NewReplacerWithPolicy(ac, ConflictError)
+
+		got, err := r.ReplaceAllChecked("x abcd", []string{"1", "2", "3"})
+		overlap, ok := err.(*OverlapError)
+		if !ok || got != "x abcd" {
+			t.Fatalf("kind %v expected an overlap error got %v %v", kind, got, err)
+		}
+		if overlap.First != (Match{pattern: 0, len: 4, end: 6}) || overlap.Second != (Match{pattern: 1, len: 2, end: 5}) {
+			t.Errorf("kind %v unexpected overlap %v", kind, overlap)
+		}
+
+		got, err = r.ReplaceAllChecked("x bc abcd?", []string{"1", "2", "3"})
+		if err == nil {
+			t.Errorf("kind %v expected an overlap error got %v", kind, got)
+		}
+		got, err = r.ReplaceAllChecked("x bc x", []string{"1", "2", "3"})
+		if err != nil || got != "3 2 3" {
+			t.Errorf("kind %v expected 3 2 3 got %v %v", kind, got, err)
+		}
+
+		haystack := []byte("abcd")
+		if got, err := r.ReplaceAllBytesChecked(haystack, [][]byte{nil, nil, nil}); err == nil || string(got) != "abcd" {
+			t.Errorf("kind %v expected an overlap error got %s %v", kind, got, err)
+		}
+		if got, err := r.AppendReplaceChecked([]byte("dst "), haystack, [][]byte{nil, nil, nil}); err == nil || string(got) != "dst " {
+			t.Errorf("kind %v expected an overlap error got %s %v", kind, got, err)
+		}
+
+		func() {
+			defer func() {
+				if _, ok := recover().(*OverlapError); !ok {
+					t.Errorf("kind %v expected a panic with an overlap error", kind)
+				}
+			}()
+			r.ReplaceAllBytes(haystack, [][]byte{nil, nil, nil})
+		}()
+	}
+}
+
+func TestReplacer_ConflictPolicyLeftmostFirst(t *testing.T) {
+	builder := NewAhoCorasickBuilder(Opts{MatchKind: LeftMostFirstMatch, Overlapping: true})
+	ac := builder.Build([]string{"ab", "abcd", "cd"})
+	r := NewReplacerWithPolicy(ac, ConflictLeftmostLongest)
+
+	// "abcd" is a candidate, even though the automaton never reports it
+	replaced := r.ReplaceAll("abcd", []string{"1", "2", "3"})
+	if replaced != "2" {
+		t.Errorf("expected 2 got %v", replaced)
+	}
+
+	// the policy needs the overlapping matches, it can't be used without them
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic")
+		}
+	}()
+	builder = NewAhoCorasickBuilder(Opts{MatchKind: LeftMostFirstMatch})
+	NewReplacerWithPolicy(builder.Build([]string{"ab"}), ConflictLeftmostLongest)
+}
+
+func TestTemplateReplacer(t *testing.T) {
+	builder := NewAhoCorasickBuilder(Opts{
+		AsciiCaseInsensitive: true,
+		MatchOnlyWholeWords:  true,
+		MatchKind:            LeftMostLongestMatch,
+	})
+	ac := builder.Build([]string{"bear", "slow", "éclair"})
+
+	r, err := NewTemplateReplacer(ac, []string{"<b>$0</b>", "${pattern}:${upper}$$", "${title}|${lower}|${0}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	haystack := "The BEAR is sLow and éCLAIR, bears"
+	expected := "The <b>BEAR</b> is 1:SLOW$ and Éclair|éclair|éCLAIR, bears"
+
+	if replaced := r.ReplaceAll(haystack); replaced != expected {
+		t.Errorf("expected %v got %v", expected, replaced)
+	}
+	if replaced := r.ReplaceAllBytes([]byte(haystack)); string(replaced) != expected {
+		t.Errorf("expected %v got %v", expected, string(replaced))
+	}
+	if replaced := r.AppendReplace([]byte("> "), []byte(haystack)); string(replaced) != "> "+expected {
+		t.Errorf("expected > %v got %v", expected, string(replaced))
+	}
+	if replaced := r.ReplaceAll("nothing"); replaced != "nothing" {
+		t.Errorf("expected nothing got %v", replaced)
+	}
+
+	for _, template := range []string{"$", "a $1", "${upper", "${nope}"} {
+		if _, err := NewTemplateReplacer(ac, []string{template, "", ""}); err == nil {
+			t.Errorf("expected an error for template %q", template)
+		}
+	}
+}
+
+func TestReplacer_PreserveCase(t *testing.T) {
+	builder := NewAhoCorasickBuilder(Opts{
+		AsciiCaseInsensitive: true,
+		MatchOnlyWholeWords:  true,
+		MatchKind:            LeftMostLongestMatch,
+	})
+	ac := builder.Build([]string{"colour", "a", "grey-ish", "42", "a-bc"})
+	r := NewReplacer(ac).PreserveCase()
+	replaceWith := []string{"color", "the", "gray-like", "forty two", "WXYZ"}
+
+	for haystack, expected := range map[string]string{
+		"colour":             "color",
+		"Colour":             "Color",
+		"COLOUR":             "COLOR",
+		"cOLour":             "cOLor",
+		"coLOUR":             "coLOR",
+		"A colour, a COLOUR": "The color, the COLOR",
+		"Grey-ish GREY-ISH":  "Gray-like GRAY-LIKE",
+		"Grey-Ish":           "Gray-Like",
+		"grEY-ish":           "grAY-like",
+		"42":                 "forty two",
+		"a-BC":               "wxYZ",
+	} {
+		if replaced := r.ReplaceAll(haystack, replaceWith); replaced != expected {
+			t.Errorf("expected %v got %v", expected, replaced)
+		}
+
+		replaceWithBytes := make([][]byte, len(replaceWith))
+		for i, rw := range replaceWith {
+			replaceWithBytes[i] = []byte(rw)
+		}
+		if replaced := r.ReplaceAllBytes([]byte(haystack), replaceWithBytes); string(replaced) != expected {
+			t.Errorf("expected %v got %v", expected, string(replaced))
+		}
+		if replaced := r.AppendReplace([]byte("- "), []byte(haystack), replaceWithBytes); string(replaced) != "- "+expected {
+			t.Errorf("expected - %v got %v", expected, string(replaced))
+		}
+	}
+
+	if replaced := NewReplacer(ac).ReplaceAll("COLOUR", replaceWith); replaced != "color" {
+		t.Errorf("expected the replacement as it is got %v", replaced)
+	}
+	// the allocations don't depend on the number of matches
+	one := testing.AllocsPerRun(10, func() {
+		_ = r.ReplaceAll("Colour", replaceWith)
+	})
+	many := testing.AllocsPerRun(10, func() {
+		_ = r.ReplaceAll(strings.Repeat("Colour ", 100), replaceWith)
+	})
+	if many > one+2 {
+		t.Errorf("expected about %v allocations for 100 matches got %v", one, many)
+	}
+}
+
+func TestReplacer_ReplaceUntilStable(t *testing.T) {
+	testCases := []struct {
+		patterns    []string
+		replaceWith []string
+		haystack    string
+		maxPasses   int
+		expected    string
+		passes      int
+		err         error
+	}{
+		{[]string{"ａ", "aa"}, []string{"a", "a"}, "ａａａａx", 10, "ax", 4, nil},
+		{[]string{"x"}, []string{"y"}, "abc", 10, "abc", 1, nil},
+		{[]string{"ab", "ba"}, []string{"ba", "ab"}, "ab", 10, "ab", 2, ErrReplaceCycle},
+		{[]string{"a"}, []string{"aa"}, "a", 100, "", 13, ErrReplaceGrowth},
+		{[]string{"aa"}, []string{"a"}, "aaaaaaaa", 2, "aa", 2, ErrNotStable},
+	}
+
+	for _, t2 := range testCases {
+		builder := NewAhoCorasickBuilder(Opts{MatchKind: LeftMostLongestMatch})
+		ac := builder.Build(t2.patterns)
+		r := NewReplacer(ac)
+
+		stable, passes, err := r.ReplaceUntilStable(t2.haystack, t2.replaceWith, t2.maxPasses)
+		if err != t2.err || passes != t2.passes {
+			t.Errorf("%v expected %v after %v passes got %v after %v", t2.haystack, t2.err, t2.passes, err, passes)
+		}
+		if t2.expected != "" && stable != t2.expected {
+			t.Errorf("expected %v got %v", t2.expected, stable)
+		}
+	}
+}
+
+func TestReplacer_ReplaceUntilStableCollision(t *testing.T) {
+	sum := func(string) uint64 {
+		return 0
+	}
+
+	builder := NewAhoCorasickBuilder(Opts{MatchKind: LeftMostLongestMatch})
+	ac := builder.Build([]string{"ab", "ba"})
+	r := NewReplacer(ac)
+
+	// "ab" -> "ba" -> "ca" all have the same hash, only "ab" -> "ba" -> "ab" is a cycle
+	if stable, passes, err := r.replaceUntilStable("ab", []string{"ba", "ca"}, 10, sum); err != nil || stable != "ca" || passes != 3 {
+		t.Errorf("expected ca after 3 passes got %v after %v, %v", stable, passes, err)
+	}
+	if _, passes, err := r.replaceUntilStable("ab", []string{"ba", "ab"}, 10, sum); err != ErrReplaceCycle || passes != 2 {
+		t.Errorf("expected %v after 2 passes got %v after %v", ErrReplaceCycle, err, passes)
+	}
+}
+
+func TestHighlighter(t *testing.T) {
+	builder := NewAhoCorasickBuilder(Opts{MatchKind: StandardMatch})
+	ac := builder.Build([]string{"abcd", "bc", "<x>", "de"})
+	haystack := []byte("<x> abcde & abc")
+
+	nested := NewHighlighter(ac, false)
+	expectedNested := []Segment{
+		{Start: 0, End: 3, Patterns: []int{2}},
+		{Start: 4, End: 5, Patterns: []int{0}},
+		{Start: 5, End: 7, Patterns: []int{0, 1}},
+		{Start: 7, End: 8, Patterns: []int{0, 3}},
+		{Start: 8, End: 9, Patterns: []int{3}},
+		{Start: 13, End: 15, Patterns: []int{1}},
+	}
+	if segments := nested.Segments(haystack); fmt.Sprint(segments) != fmt.Sprint(expectedNested) {
+		t.Errorf("expected %v got %v", expectedNested, segments)
+	}
+
+	merged := NewHighlighter(ac, true)
+	expectedMerged := []Segment{
+		{Start: 0, End: 3, Patterns: []int{2}},
+		{Start: 4, End: 9, Patterns: []int{0, 1, 3}},
+		{Start: 13, End: 15, Patterns: []int{1}},
+	}
+	if segments := merged.Segments(haystack); fmt.Sprint(segments) != fmt.Sprint(expectedMerged) {
+		t.Errorf("expected %v got %v", expectedMerged, segments)
+	}
+
+	expectedHTML := `<mark data-patterns="2">&lt;x&gt;</mark> <mark data-patterns="0 1 3">abcde</mark> &amp; a<mark data-patterns="1">bc</mark>`
+	if highlighted := merged.HTML(haystack); highlighted != expectedHTML {
+		t.Errorf("expected %v got %v", expectedHTML, highlighted)
+	}
+
+	expectedANSI := "\x1b[33m<x>\x1b[0m \x1b[31m\x1b[4mabcde\x1b[0m & a\x1b[32mbc\x1b[0m"
+	if highlighted := merged.ANSI(haystack); highlighted != expectedANSI {
+		t.Errorf("expected %q got %q", expectedANSI, highlighted)
+	}
+	if highlighted := nested.ANSI([]byte("bcd")); highlighted != "\x1b[32mbc\x1b[0md" {
+		t.Errorf("expected bc to be highlighted got %q", highlighted)
+	}
+
+	builder = NewAhoCorasickBuilder(Opts{MatchKind: LeftMostLongestMatch})
+	leftmost := builder.Build([]string{"abcd", "bc"})
+	if highlighted := NewHighlighter(leftmost, false).HTML(haystack); highlighted != `&lt;x&gt; <mark data-patterns="0">a</mark><mark data-patterns="0 1">bc</mark><mark data-patterns="0">d</mark>e &amp; a<mark data-patterns="1">bc</mark>` {
+		t.Errorf("unexpected nesting %v", highlighted)
+	}
+}
+
+func TestConvertOffsets(t *testing.T) {
+	builder := NewAhoCorasickBuilder(Opts{MatchKind: StandardMatch})
+	ac := builder.Build([]string{"é", "😀b", "c", "\xffc"})
+	haystack := []byte("aé😀bc\xffc")
+
+	var matches []Match
+	iter := ac.IterOverlappingByte(haystack)
+	for next := iter.Next(); next != nil; next = iter.Next() {
+		matches = append(matches, *next)
+	}
+
+	expected := map[Unit][]Offsets{
+		UnitByte:  {{1, 3}, {3, 8}, {8, 9}, {9, 11}, {10, 11}},
+		UnitRune:  {{1, 2}, {2, 4}, {4, 5}, {5, 7}, {6, 7}},
+		UnitUTF16: {{1, 2}, {2, 5}, {5, 6}, {6, 8}, {7, 8}},
+	}
+	for unit, offsets := range expected {
+		if converted := ConvertOffsets(haystack, matches, unit); fmt.Sprint(converted) != fmt.Sprint(offsets) {
+			t.Errorf("unit %v expected %v got %v", unit, offsets, converted)
+		}
+	}
+
+	reversed := []Match{matches[4], matches[0]}
+	if converted := ConvertOffsets(haystack, reversed, UnitUTF16); fmt.Sprint(converted) != "[{7 8} {1 2}]" {
+		t.Errorf("expected the order of the matches got %v", converted)
+	}
+}
+
+func TestLineIter(t *testing.T) {
+	builder := NewAhoCorasickBuilder(Opts{MatchKind: StandardMatch})
+	ac := builder.Build([]string{"ab\nc", "b\nc", "c", "\n"})
+	rnd := rand.New(rand.NewSource(1))
+
+	for n := 0; n < 200; n++ {
+		haystack := make([]byte, rnd.Intn(40))
+		for i := range haystack {
+			haystack[i] = "abc\n"[rnd.Intn(4)]
+		}
+
+		for _, iter := range []Iter{ac.IterByte(haystack), ac.IterOverlappingByte(haystack)} {
+			lines := NewLineIter(iter, haystack)
+			for m, ok := lines.Next(); ok; m, ok = lines.Next() {
+				before := haystack[:m.Start()]
+				line := strings.Count(string(before), "\n") + 1
+				lineStart := strings.LastIndexByte(string(before), '\n') + 1
+				lineEnd := len(haystack)
+				if i := strings.IndexByte(string(haystack[lineStart:]), '\n'); i >= 0 {
+					lineEnd = lineStart + i
+				}
+
+				if m.Line != line || m.Column != m.Start()-lineStart+1 || m.LineStart != lineStart || m.LineEnd != lineEnd {
+					t.Fatalf("%q %v expected line %v at %v..%v got %+v", haystack, m.Match, line, lineStart, lineEnd, m)
+				}
+			}
+		}
+	}
+
+	lines := NewLineIter(ac.IterByte([]byte("x\nyc")), []byte("x\nyc"))
+	if m, ok := lines.Next(); !ok || m.Line != 1 || m.Column != 2 || m.LineEnd != 1 {
+		t.Errorf("expected the newline on line 1 got %+v", m)
+	}
+	if m, ok := lines.Next(); !ok || m.Line != 2 || m.Column != 2 || m.LineStart != 2 || m.LineEnd != 4 {
+		t.Errorf("expected c on line 2 got %+v", m)
+	}
+}
+
+// sliceIter is an Iter implemented outside of the package, it only has to give matches
+type sliceIter []Match
+
+func (s *sliceIter) Next() *Match {
+	if len(*s) == 0 {
+		return nil
+	}
+	m := (*s)[0]
+	*s = (*s)[1:]
+	return &m
+}
+
+func TestLineIter_CustomIter(t *testing.T) {
+	iter := sliceIter{{pattern: 0, len: 1, end: 3}}
+	lines := NewLineIter(&iter, []byte("a\nbc"))
+	if m, ok := lines.Next(); !ok || m.Line != 2 || m.Column != 1 {
+		t.Errorf("expected a match on line 2 column 1 got %+v, %v", m, ok)
+	}
+}
+
+func TestSnippets(t *testing.T) {
+	builder := NewAhoCorasickBuilder(Opts{MatchKind: LeftMostLongestMatch, MatchOnlyWholeWords: true})
+	ac := builder.Build([]string{"fox", "dog", "café"})
+	haystack := "the quick brown fox jumps over the lazy dog, then a café crème"
+	matches := ac.FindAll(haystack)
+
+	snippets := Snippets([]byte(haystack), matches, 5, 5)
+	var texts []string
+	for _, s := range snippets {
+		texts = append(texts, fmt.Sprintf("%v:%v", haystack[s.Start:s.End], len(s.Matches)))
+	}
+	expected := "[ fox :1 lazy dog, :1  a café :1]"
+	if fmt.Sprint(texts) != expected {
+		t.Errorf("expected %v got %v", expected, texts)
+	}
+
+	merged := Snippets([]byte(haystack), matches, 20, 20)
+	if len(merged) != 1 || merged[0].Start != 0 || merged[0].End != len(haystack) || len(merged[0].Matches) != 3 {
+		t.Errorf("expected a single snippet of the haystack got %+v", merged)
+	}
+
+	// the word runs into the match, so it is cut, but not inside the é
+	builder = NewAhoCorasickBuilder(Opts{MatchKind: LeftMostLongestMatch})
+	ac = builder.Build([]string{"x"})
+	haystack = "aéééx"
+	snippets = Snippets([]byte(haystack), ac.FindAll(haystack), 4, 0)
+	if len(snippets) != 1 || haystack[snippets[0].Start:snippets[0].End] != "ééx" {
+		t.Errorf("expected ééx got %+v", snippets)
+	}
+}
+
+func TestSnippets_Negative(t *testing.T) {
+	for _, window := range [][2]int{{-1, 0}, {0, -1}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("before %v after %v expected a panic", window[0], window[1])
+				}
+			}()
+			Snippets([]byte("abc"), []Match{{pattern: 0, len: 1, end: 2}}, window[0], window[1])
+		}()
+	}
+}
+
+func TestSnippets_Large(t *testing.T) {
+	maxInt := int(^uint(0) >> 1)
+	haystack := []byte("abc def")
+	match := Match{pattern: 0, len: 1, end: 5}
+
+	snippets := Snippets(haystack, []Match{match}, maxInt, maxInt)
+	if len(snippets) != 1 || snippets[0].Start != 0 || snippets[0].End != len(haystack) {
+		t.Errorf("expected the whole haystack got %+v", snippets)
+	}
+}
+
+func TestDynamicAhoCorasick(t *testing.T) {
+	d := NewDynamicAhoCorasick(Opts{MatchKind: LeftMostLongestMatch})
+	if matches := d.FindAll("abcd"); len(matches) != 0 {
+		t.Errorf("expected no matches got %v", matches)
+	}
+
+	abc := d.Add("abc")
+	bcd := d.Add("bcd")
+	d.Compact()
+	ab := d.Add("ab")
+	abcd := d.Add("abcd")
+
+	expected := []Match{{pattern: abcd, len: 4, end: 4}, {pattern: bcd, len: 3, end: 4}}
+	if matches := d.FindAll("abcd"); fmt.Sprint(matches) != fmt.Sprint(expected) {
+		t.Errorf("expected %v got %v", expected, matches)
+	}
+
+	if !d.Remove(abcd) || !d.Remove(bcd) || d.Remove(bcd) || d.Remove(42) {
+		t.Fatal("expected abcd and bcd to be removed once")
+	}
+	expected = []Match{{pattern: abc, len: 3, end: 3}}
+	if matches := d.FindAll("abcd"); fmt.Sprint(matches) != fmt.Sprint(expected) {
+		t.Errorf("expected %v got %v", expected, matches)
+	}
+
+	replaceWith := make([]string, d.PatternCount())
+	replaceWith[abc], replaceWith[ab] = "1", "2"
+	r := NewReplacer(d)
+	if replaced := r.ReplaceAll("xabx abc", replaceWith); replaced != "x2x 1" {
+		t.Errorf("expected x2x 1 got %v", replaced)
+	}
+}
+
+func TestDynamicAhoCorasick_Segments(t *testing.T) {
+	segmentSizes := func(d *DynamicAhoCorasick) []int {
+		var sizes []int
+		for _, s := range d.segments {
+			sizes = append(sizes, len(s.ids)-s.deadCount)
+		}
+		return sizes
+	}
+
+	for _, kind := range []matchKind{StandardMatch, LeftMostLongestMatch} {
+		d := NewDynamicAhoCorasick(Opts{MatchKind: kind})
+		for i := 0; i < 100; i++ {
+			d.Add(fmt.Sprintf("<%v>", i))
+		}
+		if sizes := segmentSizes(d); fmt.Sprint(sizes) != "[64 32 4]" {
+			t.Errorf("kind %v expected segments of 64, 32 and 4 patterns got %v", kind, sizes)
+		}
+
+		// a leftmost segment is built again without the pattern, a standard one marks it dead
+		oldest := d.segments[0].ac.i
+		d.Remove(10)
+		if kept := d.segments[0].ac.i == oldest; kept != (kind == StandardMatch) {
+			t.Errorf("kind %v expected the oldest segment to be kept %v got %v", kind, kind == StandardMatch, kept)
+		}
+		if matches := d.FindAll("<10> <11>"); len(matches) != 1 || matches[0].pattern != 11 {
+			t.Errorf("kind %v expected a match of 11 got %v", kind, matches)
+		}
+
+		// removing enough patterns builds the standard segment again as well
+		for id := 11; id < 11+dynamicMinDead; id++ {
+			d.Remove(id)
+		}
+		if s := d.segments[0]; s.deadCount != 0 || len(s.ids) != 64-1-dynamicMinDead {
+			t.Errorf("kind %v expected the oldest segment to be built again got %v patterns, %v dead", kind, len(s.ids), s.deadCount)
+		}
+
+		d.Compact()
+		if sizes := segmentSizes(d); fmt.Sprint(sizes) != fmt.Sprint([]int{100 - 1 - dynamicMinDead}) {
+			t.Errorf("kind %v expected a single segment got %v", kind, sizes)
+		}
+	}
+}
+
+func TestDynamicAhoCorasick_SingleAutomaton(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	for n := 0; n < 300; n++ {
+		opts := Opts{
+			MatchKind:            []matchKind{StandardMatch, LeftMostFirstMatch, LeftMostLongestMatch}[n%3],
+			DFA:                  rnd.Intn(2) == 0,
+			MatchOnlyWholeWords:  rnd.Intn(3) == 0,
+			AsciiCaseInsensitive: rnd.Intn(2) == 0,
+		}
+		d := NewDynamicAhoCorasick(opts)
+		patterns := make(map[int]string)
+
+		for i := 0; i < 80; i++ {
+			if rnd.Intn(20) == 0 {
+				d.Compact()
+			}
+			if len(patterns) > 0 && rnd.Intn(3) == 0 {
+				for id := range patterns {
+					d.Remove(id)
+					delete(patterns, id)
+					break
+				}
+				continue
+			}
+
+			pattern := make([]byte, 1+rnd.Intn(4))
+			for i := range pattern {
+				pattern[i] = "abc "[rnd.Intn(4)]
+			}
+			patterns[d.Add(string(pattern))] = string(pattern)
+		}
+
+		var ids []int
+		var live []string
+		for id := 0; id < d.PatternCount(); id++ {
+			if pattern, ok := patterns[id]; ok {
+				ids = append(ids, id)
+				live = append(live, pattern)
+			}
+		}
+		builder := NewAhoCorasickBuilder(opts)
+		ac := builder.Build(live)
+
+		haystack := make([]byte, rnd.Intn(40))
+		for i := range haystack {
+			haystack[i] = "abcAB "[rnd.Intn(6)]
+		}
+
+		expected := ac.FindAll(string(haystack))
+		for i := range expected {
+			expected[i].pattern = ids[expected[i].pattern]
+		}
+		if matches := d.FindAll(string(haystack)); fmt.Sprint(matches) != fmt.Sprint(expected) {
+			t.Fatalf("%+v patterns %q haystack %q expected %v got %v", opts, live, haystack, expected, matches)
+		}
+	}
+}
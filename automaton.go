@@ -9,39 +9,38 @@ type automaton interface {
 	IsValid(stateID) bool
 	IsMatchState(stateID) bool
 	IsMatchOrDeadState(stateID) bool
-	GetMatch(stateID, int, int) *Match
+	GetMatch(stateID, int, int) (Match, bool)
 	MatchCount(stateID) int
 	NextState(stateID, byte) stateID
 	NextStateNoFail(stateID, byte) stateID
-	StandardFindAt(*prefilterState, []byte, int, *stateID) *Match
-	StandardFindAtImp(*prefilterState, prefilter, []byte, int, *stateID) *Match
-	LeftmostFindAt(*prefilterState, []byte, int, *stateID) *Match
-	LeftmostFindAtImp(*prefilterState, prefilter, []byte, int, *stateID) *Match
-	LeftmostFindAtNoState(*prefilterState, []byte, int) *Match
-	LeftmostFindAtNoStateImp(*prefilterState, prefilter, []byte, int) *Match
-	OverlappingFindAt(*prefilterState, []byte, int, *stateID, *int) *Match
-	EarliestFindAt(*prefilterState, []byte, int, *stateID) *Match
-	FindAt(*prefilterState, []byte, int, *stateID) *Match
-	FindAtNoState(*prefilterState, []byte, int) *Match
+	StandardFindAt(*prefilterState, []byte, int, *stateID) (Match, bool)
+	StandardFindAtImp(*prefilterState, prefilter, []byte, int, *stateID) (Match, bool)
+	LeftmostFindAt(*prefilterState, []byte, int, *stateID) (Match, bool)
+	LeftmostFindAtImp(*prefilterState, prefilter, []byte, int, *stateID) (Match, bool)
+	LeftmostFindAtNoState(*prefilterState, []byte, int) (Match, bool)
+	LeftmostFindAtNoStateImp(*prefilterState, prefilter, []byte, int) (Match, bool)
+	OverlappingFindAt(*prefilterState, []byte, int, *stateID, *int) (Match, bool)
+	EarliestFindAt(*prefilterState, []byte, int, *stateID) (Match, bool)
+	FindAt(*prefilterState, []byte, int, *stateID) (Match, bool)
+	FindAtNoState(*prefilterState, []byte, int) (Match, bool)
 }
 
 func isMatchOrDeadState(a automaton, si stateID) bool {
 	return si == deadStateID || a.IsMatchState(si)
 }
 
-func standardFindAt(a automaton, prestate *prefilterState, haystack []byte, at int, sID *stateID) *Match {
+func standardFindAt(a automaton, prestate *prefilterState, haystack []byte, at int, sID *stateID) (Match, bool) {
 	pre := a.Prefilter()
 	return a.StandardFindAtImp(prestate, pre, haystack, at, sID)
 }
 
-func standardFindAtImp(a automaton, prestate *prefilterState, prefilter prefilter, haystack []byte, at int, sID *stateID) *Match {
+func standardFindAtImp(a automaton, prestate *prefilterState, prefilter prefilter, haystack []byte, at int, sID *stateID) (Match, bool) {
 	for at < len(haystack) {
 		if prefilter != nil {
-			startState := a.StartState()
-			if prestate.IsEffective(at) && sID == &startState {
+			if prestate.IsEffective(at) && *sID == a.StartState() {
 				c := nextPrefilter(prestate, prefilter, haystack, at)
 				if c == noneCandidate {
-					return nil
+					return Match{}, false
 				} else {
 					at = c
 				}
@@ -52,33 +51,32 @@ func standardFindAtImp(a automaton, prestate *prefilterState, prefilter prefilte
 
 		if a.IsMatchOrDeadState(*sID) {
 			if *sID == deadStateID {
-				return nil
+				return Match{}, false
 			} else {
 				return a.GetMatch(*sID, 0, at)
 			}
 		}
 	}
-	return nil
+	return Match{}, false
 }
 
-func leftmostFindAt(a automaton, prestate *prefilterState, haystack []byte, at int, sID *stateID) *Match {
+func leftmostFindAt(a automaton, prestate *prefilterState, haystack []byte, at int, sID *stateID) (Match, bool) {
 	prefilter := a.Prefilter()
 	return a.LeftmostFindAtImp(prestate, prefilter, haystack, at, sID)
 }
 
-func leftmostFindAtImp(a automaton, prestate *prefilterState, prefilter prefilter, haystack []byte, at int, sID *stateID) *Match {
+func leftmostFindAtImp(a automaton, prestate *prefilterState, prefilter prefilter, haystack []byte, at int, sID *stateID) (Match, bool) {
 	if a.Anchored() && at > 0 && *sID == a.StartState() {
-		return nil
+		return Match{}, false
 	}
-	lastMatch := a.GetMatch(*sID, 0, at)
+	lastMatch, ok := a.GetMatch(*sID, 0, at)
 
 	for at < len(haystack) {
 		if prefilter != nil {
-			startState := a.StartState()
-			if prestate.IsEffective(at) && sID == &startState {
+			if prestate.IsEffective(at) && *sID == a.StartState() {
 				c := nextPrefilter(prestate, prefilter, haystack, at)
 				if c == noneCandidate {
-					return nil
+					return Match{}, false
 				} else {
 					at = c
 				}
@@ -90,39 +88,39 @@ func leftmostFindAtImp(a automaton, prestate *prefilterState, prefilter prefilte
 
 		if a.IsMatchOrDeadState(*sID) {
 			if *sID == deadStateID {
-				return lastMatch
+				return lastMatch, ok
 			} else {
-				a.GetMatch(*sID, 0, at)
+				lastMatch, ok = a.GetMatch(*sID, 0, at)
 			}
 		}
 	}
 
-	return lastMatch
+	return lastMatch, ok
 }
 
-func leftmostFindAtNoState(a automaton, prestate *prefilterState, haystack []byte, at int) *Match {
+func leftmostFindAtNoState(a automaton, prestate *prefilterState, haystack []byte, at int) (Match, bool) {
 	return leftmostFindAtNoStateImp(a, prestate, a.Prefilter(), haystack, at)
 }
 
-func leftmostFindAtNoStateImp(a automaton, prestate *prefilterState, prefilter prefilter, haystack []byte, at int) *Match {
+func leftmostFindAtNoStateImp(a automaton, prestate *prefilterState, prefilter prefilter, haystack []byte, at int) (Match, bool) {
 	if a.Anchored() && at > 0 {
-		return nil
+		return Match{}, false
 	}
 	if prefilter != nil && !prefilter.ReportsFalsePositives() {
 		c := prefilter.NextCandidate(prestate, haystack, at)
 		if c == noneCandidate {
-			return nil
+			return Match{}, false
 		}
 	}
 
 	stateID := a.StartState()
-	lastMatch := a.GetMatch(stateID, 0, at)
+	lastMatch, ok := a.GetMatch(stateID, 0, at)
 
 	for at < len(haystack) {
 		if prefilter != nil && prestate.IsEffective(at) && stateID == a.StartState() {
-			c := prefilter.NextCandidate(prestate, haystack, at)
+			c := nextPrefilter(prestate, prefilter, haystack, at)
 			if c == noneCandidate {
-				return nil
+				return Match{}, false
 			} else {
 				at = c
 			}
@@ -133,56 +131,56 @@ func leftmostFindAtNoStateImp(a automaton, prestate *prefilterState, prefilter p
 
 		if a.IsMatchOrDeadState(stateID) {
 			if stateID == deadStateID {
-				return lastMatch
+				return lastMatch, ok
 			}
-			lastMatch = a.GetMatch(stateID, 0, at)
+			lastMatch, ok = a.GetMatch(stateID, 0, at)
 		}
 	}
 
-	return lastMatch
+	return lastMatch, ok
 }
 
-func overlappingFindAt(a automaton, prestate *prefilterState, haystack []byte, at int, id *stateID, matchIndex *int) *Match {
+func overlappingFindAt(a automaton, prestate *prefilterState, haystack []byte, at int, id *stateID, matchIndex *int) (Match, bool) {
 	if a.Anchored() && at > 0 && *id == a.StartState() {
-		return nil
+		return Match{}, false
 	}
 
 	matchCount := a.MatchCount(*id)
 
 	if *matchIndex < matchCount {
-		result := a.GetMatch(*id, *matchIndex, at)
+		result, ok := a.GetMatch(*id, *matchIndex, at)
 		*matchIndex += 1
-		return result
+		return result, ok
 	}
 
 	*matchIndex = 0
-	match := a.StandardFindAt(prestate, haystack, at, id)
+	match, ok := a.StandardFindAt(prestate, haystack, at, id)
 
-	if match == nil {
-		return nil
+	if !ok {
+		return Match{}, false
 	}
 
 	*matchIndex = 1
-	return match
+	return match, true
 }
 
-func earliestFindAt(a automaton, prestate *prefilterState, haystack []byte, at int, id *stateID) *Match {
+func earliestFindAt(a automaton, prestate *prefilterState, haystack []byte, at int, id *stateID) (Match, bool) {
 	if *id == a.StartState() {
 		if a.Anchored() && at > 0 {
-			return nil
+			return Match{}, false
 		}
-		match := a.GetMatch(*id, 0, at)
-		if match != nil {
-			return match
+		if match, ok := a.GetMatch(*id, 0, at); ok {
+			return match, true
 		}
 	}
-	return a.StandardFindAt(prestate, haystack, at, id)
+	// not through the automaton interface, so the state doesn't escape
+	return standardFindAtImp(a, prestate, a.Prefilter(), haystack, at, id)
 }
 
-func findAt(a automaton, prestate *prefilterState, haystack []byte, at int, id *stateID) *Match {
+func findAt(a automaton, prestate *prefilterState, haystack []byte, at int, id *stateID) (Match, bool) {
 	kind := a.MatchKind()
 	if kind == nil {
-		return nil
+		return Match{}, false
 	}
 	switch *kind {
 	case StandardMatch:
@@ -190,20 +188,20 @@ func findAt(a automaton, prestate *prefilterState, haystack []byte, at int, id *
 	case LeftMostFirstMatch, LeftMostLongestMatch:
 		return a.LeftmostFindAt(prestate, haystack, at, id)
 	}
-	return nil
+	return Match{}, false
 }
 
-func findAtNoState(a automaton, prestate *prefilterState, haystack []byte, at int) *Match {
+func findAtNoState(a automaton, prestate *prefilterState, haystack []byte, at int) (Match, bool) {
 	kind := a.MatchKind()
 	if kind == nil {
-		return nil
+		return Match{}, false
 	}
 	switch *kind {
 	case StandardMatch:
 		state := a.StartState()
-		return a.EarliestFindAt(prestate, haystack, at, &state)
+		return earliestFindAt(a, prestate, haystack, at, &state)
 	case LeftMostFirstMatch, LeftMostLongestMatch:
 		return a.LeftmostFindAtNoState(prestate, haystack, at)
 	}
-	return nil
+	return Match{}, false
 }
@@ -0,0 +1,57 @@
+package aho_corasick
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// FindAllBatch calls `fn` with the matches FindAll would return for every haystack, in order.
+// It reuses the search state between the haystacks, `docIdx` is the index of the haystack
+func (ac AhoCorasick) FindAllBatch(haystacks [][]byte, fn func(docIdx int, m Match)) {
+	var prestate prefilterState
+	iter := newFindIter(ac, &prestate, nil)
+
+	for docIdx, haystack := range haystacks {
+		iter.reset(ac, haystack)
+		for m, ok := iter.next(); ok; m, ok = iter.next() {
+			fn(docIdx, m)
+		}
+	}
+}
+
+// FindAllBatchParallel is FindAllBatch with the haystacks spread over `workers` goroutines, or GOMAXPROCS if it's not positive.
+// `fn` is called concurrently, only the matches of the same haystack are in order
+func (ac AhoCorasick) FindAllBatchParallel(haystacks [][]byte, workers int, fn func(docIdx int, m Match)) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(haystacks) {
+		workers = len(haystacks)
+	}
+
+	var next int64 = -1
+	var wg sync.WaitGroup
+
+	for k := 0; k < workers; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var prestate prefilterState
+			iter := newFindIter(ac, &prestate, nil)
+
+			for {
+				docIdx := int(atomic.AddInt64(&next, 1))
+				if docIdx >= len(haystacks) {
+					return
+				}
+
+				iter.reset(ac, haystacks[docIdx])
+				for m, ok := iter.next(); ok; m, ok = iter.next() {
+					fn(docIdx, m)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
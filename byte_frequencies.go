@@ -1,5 +1,10 @@
 package aho_corasick
 
+import (
+	"io"
+	"sort"
+)
+
 var byteFrequencies = [256]byte{
 	55,  // '\x00'
 	52,  // '\x01'
@@ -258,3 +263,58 @@ var byteFrequencies = [256]byte{
 	255, // 'þ'
 	255, // 'ÿ'
 }
+
+// maxConsecutiveEmptyReads is the number of reads without data after which LearnByteFrequencies gives up
+const maxConsecutiveEmptyReads = 100
+
+// LearnByteFrequencies derives a byte frequency ranking for Opts.ByteFrequencies from a representative sample of haystacks.
+// The ranks are spread over 0 to 255 by how often each byte occurs, bytes that occur equally often get the same rank
+// and bytes that don't occur at all are ranked 0.
+// A reader that keeps returning no bytes and no error fails with io.ErrNoProgress, like it does in bufio
+func LearnByteFrequencies(sample io.Reader) (*[256]byte, error) {
+	var counts [256]int
+	buf := make([]byte, 32*1024)
+	emptyReads := 0
+
+	for {
+		n, err := sample.Read(buf)
+		if n == 0 && err == nil {
+			emptyReads += 1
+			if emptyReads >= maxConsecutiveEmptyReads {
+				return nil, io.ErrNoProgress
+			}
+			continue
+		}
+		emptyReads = 0
+		for _, b := range buf[:n] {
+			counts[b] += 1
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	order := make([]int, 256)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return counts[order[i]] < counts[order[j]]
+	})
+
+	var frequencies [256]byte
+	for i, b := range order {
+		switch {
+		case counts[b] == 0:
+			frequencies[b] = 0
+		case i > 0 && counts[b] == counts[order[i-1]]:
+			frequencies[b] = frequencies[order[i-1]]
+		default:
+			frequencies[b] = byte(i)
+		}
+	}
+	return &frequencies, nil
+}
@@ -0,0 +1,132 @@
+package aho_corasick
+
+// Byte sets are the fallback for start and rare bytes, when there are more than 3 of them
+// or some of them are not ascii, which the memchr based prefilters don't handle.
+// They look up every haystack byte in a 256 entry table, so they are only worth it for rare bytes.
+const (
+	byteSetMaxBytes   = 16
+	byteSetMaxAvgRank = 200
+)
+
+type startByteSet struct {
+	set byteSet
+}
+
+func (s *startByteSet) NextCandidate(_ *prefilterState, haystack []byte, at int) int {
+	for i, b := range haystack[at:] {
+		if s.set.contains(b) {
+			return at + i
+		}
+	}
+	return noneCandidate
+}
+
+func (s *startByteSet) HeapBytes() int {
+	return 0
+}
+
+func (s *startByteSet) ReportsFalsePositives() bool {
+	return true
+}
+
+func (s *startByteSet) LooksForNonStartOfMatch() bool {
+	return false
+}
+
+func (s *startByteSet) clone() prefilter {
+	if s == nil {
+		return nil
+	}
+	u := *s
+	return &u
+}
+
+type rareByteSet struct {
+	set     byteSet
+	offsets rareByteOffsets
+}
+
+func (r *rareByteSet) NextCandidate(state *prefilterState, haystack []byte, at int) int {
+	for i, b := range haystack[at:] {
+		if r.set.contains(b) {
+			return r.offsets.candidate(state, haystack, at, at+i)
+		}
+	}
+	return noneCandidate
+}
+
+func (r *rareByteSet) HeapBytes() int {
+	return 0
+}
+
+func (r *rareByteSet) ReportsFalsePositives() bool {
+	return true
+}
+
+func (r *rareByteSet) LooksForNonStartOfMatch() bool {
+	return true
+}
+
+func (r *rareByteSet) clone() prefilter {
+	if r == nil {
+		return nil
+	}
+	u := *r
+	return &u
+}
+
+// newByteSet builds the table for the folded bytes in `folded`, which is indexed by byte.
+// It gives nil if the bytes are too common on average, according to their ranks
+func newByteSet(folded *byteSet, asciiCaseInsensitive bool, rankSum uint16) *byteSet {
+	var set byteSet
+	var length int
+
+	for b := 0; b < 256; b++ {
+		if !folded.contains(byte(b)) {
+			continue
+		}
+		if set.insert(byte(b)) {
+			length += 1
+		}
+		if asciiCaseInsensitive && set.insert(oppositeAsciiCase(byte(b))) {
+			length += 1
+		}
+	}
+
+	if length == 0 || int(rankSum) > byteSetMaxAvgRank*length {
+		return nil
+	}
+	return &set
+}
+
+func (s *startBytesBuilder) buildSet() prefilter {
+	if s.count > byteSetMaxBytes {
+		return nil
+	}
+
+	var folded byteSet
+	for b := 0; b < 256; b++ {
+		folded[b] = s.byteset[b]
+	}
+
+	set := newByteSet(&folded, s.asciiCaseInsensitive, s.rankSum)
+	if set == nil {
+		return nil
+	}
+	return &startByteSet{set: *set}
+}
+
+func (r *rareBytesBuilder) buildSet() prefilter {
+	if !r.available || r.count > byteSetMaxBytes {
+		return nil
+	}
+
+	set := newByteSet(&r.rareSet, r.asciiCaseInsensitive, r.rankSum)
+	if set == nil {
+		return nil
+	}
+	return &rareByteSet{
+		set:     *set,
+		offsets: r.byteOffsets,
+	}
+}
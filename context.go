@@ -0,0 +1,113 @@
+package aho_corasick
+
+import "context"
+
+// the context is checked whenever this many bytes of the haystack have been searched or this many matches have been found
+const (
+	contextCheckBytes   = 64 * 1024
+	contextCheckMatches = 1024
+)
+
+// FindAllContext returns the matches found in the haystack, like FindAll.
+// The search stops when the context is done, it then returns the matches found so far and the error of the context.
+// A context that can't be canceled is not checked at all
+func (ac AhoCorasick) FindAllContext(ctx context.Context, haystack string) ([]Match, error) {
+	matches := make([]Match, 0)
+	if ctx.Done() == nil {
+		return ac.AppendMatches(matches, []byte(haystack)), nil
+	}
+
+	iter := ac.IterContext(ctx, []byte(haystack))
+	for m, ok := iter.Next(); ok; m, ok = iter.Next() {
+		matches = append(matches, m)
+	}
+	return matches, iter.Err()
+}
+
+// FindAllBatchContext is FindAllBatch, which stops when the context is done.
+// It then returns the error of the context, after `fn` has been called with the matches found so far
+func (ac AhoCorasick) FindAllBatchContext(ctx context.Context, haystacks [][]byte, fn func(docIdx int, m Match)) error {
+	if ctx.Done() == nil {
+		ac.FindAllBatch(haystacks, fn)
+		return nil
+	}
+
+	iter := ac.IterContext(ctx, nil)
+	for docIdx, haystack := range haystacks {
+		iter.Reset(haystack)
+		for m, ok := iter.Next(); ok; m, ok = iter.Next() {
+			fn(docIdx, m)
+		}
+		if err := iter.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ContextIter is an iterator over the matches FindAll would return, which stops when its context is done
+type ContextIter struct {
+	ac       AhoCorasick
+	ctx      context.Context
+	prestate prefilterState
+	haystack []byte
+	at       int
+	checkAt  int
+	found    int
+	err      error
+}
+
+// IterContext gives an iterator over the built patterns, which gives the matches by value and stops when the context is done
+func (ac AhoCorasick) IterContext(ctx context.Context, haystack []byte) *ContextIter {
+	c := &ContextIter{ac: ac, ctx: ctx}
+	c.Reset(haystack)
+	return c
+}
+
+// Reset makes the iterator search `haystack` from the start, the error of a done context is kept
+func (c *ContextIter) Reset(haystack []byte) {
+	c.prestate = c.ac.newPrefilterState()
+	c.haystack = haystack
+	c.at, c.checkAt, c.found = 0, 0, 0
+}
+
+// Err gives the error of the context, once the iterator stopped because it is done
+func (c *ContextIter) Err() error {
+	return c.err
+}
+
+// Next gives the next match, ok is false if there is none or the context is done.
+// The haystack is searched in windows of contextCheckBytes, so a search without matches doesn't run past a check
+func (c *ContextIter) Next() (match Match, ok bool) {
+	for c.err == nil && c.at <= len(c.haystack) {
+		if c.at >= c.checkAt || c.found >= contextCheckMatches {
+			select {
+			case <-c.ctx.Done():
+				c.err = c.ctx.Err()
+				return Match{}, false
+			default:
+			}
+			c.checkAt, c.found = c.at+contextCheckBytes, 0
+		}
+
+		hi := c.checkAt
+		if hi > len(c.haystack) {
+			hi = len(c.haystack) + 1
+		}
+
+		m, ok := findBefore(c.ac.i, &c.prestate, c.haystack, c.at, hi)
+		if !ok || m.Start() >= hi {
+			c.at = hi
+			continue
+		}
+
+		c.at = m.Start() + 1
+		c.found += 1
+
+		if c.ac.matchOnlyWholeWords && !isWholeWord(c.haystack, m) {
+			continue
+		}
+		return m, true
+	}
+	return Match{}, false
+}
@@ -0,0 +1,123 @@
+package aho_corasick
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// overlapping searches pass pointers into the iterator through the automaton, which makes it escape.
+// Pooling it keeps counting free of allocations
+var overlappingIterPool = sync.Pool{
+	New: func() interface{} {
+		return new(overlappingIter)
+	},
+}
+
+// Count returns the number of matches FindAll would return, without collecting them
+func (ac AhoCorasick) Count(haystack []byte) int {
+	return ac.count(haystack, false, nil)
+}
+
+// CountByPattern adds the number of matches of every pattern FindAll would return to `counts`, which is indexed by pattern.
+// It panics, if `counts` is shorter than the pattern count
+func (ac AhoCorasick) CountByPattern(haystack []byte, counts []int) {
+	if len(counts) < ac.PatternCount() {
+		panic("counts needs to have at least the length of the pattern count")
+	}
+	ac.count(haystack, false, counts)
+}
+
+// CountOverlapping returns the number of overlapping matches, the same IterOverlappingByte finds.
+// It panics for the leftmost match kinds, unless the automaton was built with Opts.Overlapping
+func (ac AhoCorasick) CountOverlapping(haystack []byte) int {
+	return ac.count(haystack, true, nil)
+}
+
+// CountOverlappingByPattern is CountByPattern for overlapping matches.
+// It panics for the leftmost match kinds, unless the automaton was built with Opts.Overlapping
+func (ac AhoCorasick) CountOverlappingByPattern(haystack []byte, counts []int) {
+	if len(counts) < ac.PatternCount() {
+		panic("counts needs to have at least the length of the pattern count")
+	}
+	ac.count(haystack, true, counts)
+}
+
+func (ac AhoCorasick) count(haystack []byte, overlapping bool, counts []int) int {
+	if overlapping {
+		ac = ac.overlapping()
+	}
+
+	prestate := prestatePool.Get().(*prefilterState)
+	defer prestatePool.Put(prestate)
+	*prestate = ac.newPrefilterState()
+
+	count := 0
+
+	if overlapping {
+		iter := overlappingIterPool.Get().(*overlappingIter)
+		defer func() {
+			*iter = overlappingIter{}
+			overlappingIterPool.Put(iter)
+		}()
+		*iter = newOverlappingIter(ac, prestate, haystack)
+
+		for m, ok := iter.next(); ok; m, ok = iter.next() {
+			count += 1
+			if counts != nil {
+				counts[m.pattern] += 1
+			}
+		}
+		return count
+	}
+
+	iter := newFindIter(ac, prestate, haystack)
+	for m, ok := iter.next(); ok; m, ok = iter.next() {
+		count += 1
+		if counts != nil {
+			counts[m.pattern] += 1
+		}
+	}
+	return count
+}
+
+// MatchingPatterns returns the patterns that occur anywhere in the haystack, in ascending order.
+// It looks at overlapping matches, so no pattern is hidden by another one, and stops as soon as every pattern has been seen.
+// It panics for the leftmost match kinds, unless the automaton was built with Opts.Overlapping
+func (ac AhoCorasick) MatchingPatterns(haystack []byte) []int {
+	ac = ac.overlapping()
+
+	patternCount := ac.PatternCount()
+	seen := make([]uint64, (patternCount+63)/64)
+	distinct := 0
+
+	prestate := prestatePool.Get().(*prefilterState)
+	defer prestatePool.Put(prestate)
+	*prestate = ac.newPrefilterState()
+
+	iter := overlappingIterPool.Get().(*overlappingIter)
+	defer func() {
+		*iter = overlappingIter{}
+		overlappingIterPool.Put(iter)
+	}()
+	*iter = newOverlappingIter(ac, prestate, haystack)
+
+	for m, ok := iter.next(); ok; m, ok = iter.next() {
+		word, bit := m.pattern/64, uint64(1)<<uint(m.pattern%64)
+		if seen[word]&bit != 0 {
+			continue
+		}
+		seen[word] |= bit
+		distinct += 1
+		if distinct == patternCount {
+			break
+		}
+	}
+
+	patterns := make([]int, 0, distinct)
+	for word, w := range seen {
+		for ; w != 0; w &= w - 1 {
+			patterns = append(patterns, word*64+bits.TrailingZeros64(w))
+		}
+	}
+	return patterns
+}
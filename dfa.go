@@ -36,19 +36,19 @@ func (d iDFA) UsePrefilter() bool {
 	return !p.LooksForNonStartOfMatch()
 }
 
-func (d iDFA) OverlappingFindAt(prestate *prefilterState, haystack []byte, at int, state_id *stateID, match_index *int) *Match {
+func (d iDFA) OverlappingFindAt(prestate *prefilterState, haystack []byte, at int, state_id *stateID, match_index *int) (Match, bool) {
 	return overlappingFindAt(d.atom, prestate, haystack, at, state_id, match_index)
 }
 
-func (d iDFA) EarliestFindAt(prestate *prefilterState, haystack []byte, at int, state_id *stateID) *Match {
+func (d iDFA) EarliestFindAt(prestate *prefilterState, haystack []byte, at int, state_id *stateID) (Match, bool) {
 	return earliestFindAt(d.atom, prestate, haystack, at, state_id)
 }
 
-func (d iDFA) FindAtNoState(prestate *prefilterState, haystack []byte, at int) *Match {
+func (d iDFA) FindAtNoState(prestate *prefilterState, haystack []byte, at int) (Match, bool) {
 	return findAtNoState(d.atom, prestate, haystack, at)
 }
 
-func (n iDFA) LeftmostFindAtNoState(prestate *prefilterState, haystack []byte, at int) *Match {
+func (n iDFA) LeftmostFindAtNoState(prestate *prefilterState, haystack []byte, at int) (Match, bool) {
 	return leftmostFindAtNoState(n.atom, prestate, haystack, at)
 }
 
@@ -128,58 +128,58 @@ type iByteClass struct {
 	repr *iRepr
 }
 
-func (p iByteClass) FindAtNoState(prefilterState *prefilterState, bytes []byte, i int) *Match {
+func (p *iByteClass) FindAtNoState(prefilterState *prefilterState, bytes []byte, i int) (Match, bool) {
 	return findAtNoState(p, prefilterState, bytes, i)
 }
 
-func (p iByteClass) Repr() *iRepr {
+func (p *iByteClass) Repr() *iRepr {
 	return p.repr
 }
 
-func (p iByteClass) MatchKind() *matchKind {
+func (p *iByteClass) MatchKind() *matchKind {
 	return &p.repr.match_kind
 }
 
-func (p iByteClass) Anchored() bool {
+func (p *iByteClass) Anchored() bool {
 	return p.repr.anchored
 }
 
-func (p iByteClass) Prefilter() prefilter {
+func (p *iByteClass) Prefilter() prefilter {
 	return p.repr.prefilter
 }
 
-func (p iByteClass) StartState() stateID {
+func (p *iByteClass) StartState() stateID {
 	return p.repr.start_id
 }
 
-func (b iByteClass) IsValid(id stateID) bool {
+func (b *iByteClass) IsValid(id stateID) bool {
 	return int(id) < b.repr.state_count
 }
 
-func (b iByteClass) IsMatchState(id stateID) bool {
+func (b *iByteClass) IsMatchState(id stateID) bool {
 	return b.repr.isMatchState(id)
 }
 
-func (b iByteClass) IsMatchOrDeadState(id stateID) bool {
+func (b *iByteClass) IsMatchOrDeadState(id stateID) bool {
 	return b.repr.isMatchStateOrDeadState(id)
 }
 
-func (b iByteClass) GetMatch(id stateID, i int, i2 int) *Match {
+func (b *iByteClass) GetMatch(id stateID, i int, i2 int) (Match, bool) {
 	return b.repr.GetMatch(id, i, i2)
 }
 
-func (b iByteClass) MatchCount(id stateID) int {
+func (b *iByteClass) MatchCount(id stateID) int {
 	return b.repr.MatchCount(id)
 }
 
-func (b iByteClass) NextState(id stateID, b2 byte) stateID {
+func (b *iByteClass) NextState(id stateID, b2 byte) stateID {
 	alphabet_len := b.repr.byte_classes.alphabetLen()
 	input := b.repr.byte_classes.bytes[b2]
 	o := int(id)*alphabet_len + int(input)
 	return b.repr.trans[o]
 }
 
-func (p iByteClass) NextStateNoFail(id stateID, b byte) stateID {
+func (p *iByteClass) NextStateNoFail(id stateID, b byte) stateID {
 	next := p.NextState(id, b)
 	if next == failedStateID {
 		panic("automaton should never return fail_id for next state")
@@ -187,108 +187,108 @@ func (p iByteClass) NextStateNoFail(id stateID, b byte) stateID {
 	return next
 }
 
-func (p iByteClass) StandardFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) *Match {
-	return standardFindAt(&p, prefilterState, bytes, i, id)
+func (p *iByteClass) StandardFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) (Match, bool) {
+	return standardFindAt(p, prefilterState, bytes, i, id)
 }
 
-func (p iByteClass) StandardFindAtImp(prefilterState *prefilterState, prefilter prefilter, bytes []byte, i int, id *stateID) *Match {
-	return standardFindAtImp(&p, prefilterState, prefilter, bytes, i, id)
+func (p *iByteClass) StandardFindAtImp(prefilterState *prefilterState, prefilter prefilter, bytes []byte, i int, id *stateID) (Match, bool) {
+	return standardFindAtImp(p, prefilterState, prefilter, bytes, i, id)
 }
 
-func (p iByteClass) LeftmostFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) *Match {
-	return leftmostFindAt(&p, prefilterState, bytes, i, id)
+func (p *iByteClass) LeftmostFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) (Match, bool) {
+	return leftmostFindAt(p, prefilterState, bytes, i, id)
 }
 
-func (p iByteClass) LeftmostFindAtImp(prefilterState *prefilterState, prefilter prefilter, bytes []byte, i int, id *stateID) *Match {
-	return leftmostFindAtImp(&p, prefilterState, prefilter, bytes, i, id)
+func (p *iByteClass) LeftmostFindAtImp(prefilterState *prefilterState, prefilter prefilter, bytes []byte, i int, id *stateID) (Match, bool) {
+	return leftmostFindAtImp(p, prefilterState, prefilter, bytes, i, id)
 }
 
-func (p iByteClass) LeftmostFindAtNoState(prefilterState *prefilterState, bytes []byte, i int) *Match {
-	return leftmostFindAtNoState(&p, prefilterState, bytes, i)
+func (p *iByteClass) LeftmostFindAtNoState(prefilterState *prefilterState, bytes []byte, i int) (Match, bool) {
+	return leftmostFindAtNoState(p, prefilterState, bytes, i)
 }
 
-func (p iByteClass) LeftmostFindAtNoStateImp(prefilterState *prefilterState, prefilter prefilter, bytes []byte, i int) *Match {
-	return leftmostFindAtNoStateImp(&p, prefilterState, prefilter, bytes, i)
+func (p *iByteClass) LeftmostFindAtNoStateImp(prefilterState *prefilterState, prefilter prefilter, bytes []byte, i int) (Match, bool) {
+	return leftmostFindAtNoStateImp(p, prefilterState, prefilter, bytes, i)
 }
 
-func (p iByteClass) OverlappingFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID, i2 *int) *Match {
-	return overlappingFindAt(&p, prefilterState, bytes, i, id, i2)
+func (p *iByteClass) OverlappingFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID, i2 *int) (Match, bool) {
+	return overlappingFindAt(p, prefilterState, bytes, i, id, i2)
 }
 
-func (p iByteClass) EarliestFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) *Match {
-	return earliestFindAt(&p, prefilterState, bytes, i, id)
+func (p *iByteClass) EarliestFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) (Match, bool) {
+	return earliestFindAt(p, prefilterState, bytes, i, id)
 }
 
-func (p iByteClass) FindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) *Match {
-	return findAt(&p, prefilterState, bytes, i, id)
+func (p *iByteClass) FindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) (Match, bool) {
+	return findAt(p, prefilterState, bytes, i, id)
 }
 
 type iPremultipliedByteClass struct {
 	repr *iRepr
 }
 
-func (p iPremultipliedByteClass) FindAtNoState(prefilterState *prefilterState, bytes []byte, i int) *Match {
+func (p *iPremultipliedByteClass) FindAtNoState(prefilterState *prefilterState, bytes []byte, i int) (Match, bool) {
 	return findAtNoState(p, prefilterState, bytes, i)
 }
 
-func (p iPremultipliedByteClass) Repr() *iRepr {
+func (p *iPremultipliedByteClass) Repr() *iRepr {
 	return p.repr
 }
 
-func (p iPremultipliedByteClass) MatchKind() *matchKind {
+func (p *iPremultipliedByteClass) MatchKind() *matchKind {
 	return &p.repr.match_kind
 }
 
-func (p iPremultipliedByteClass) Anchored() bool {
+func (p *iPremultipliedByteClass) Anchored() bool {
 	return p.repr.anchored
 }
 
-func (p iPremultipliedByteClass) Prefilter() prefilter {
+func (p *iPremultipliedByteClass) Prefilter() prefilter {
 	return p.repr.prefilter
 }
 
-func (p iPremultipliedByteClass) StartState() stateID {
+func (p *iPremultipliedByteClass) StartState() stateID {
 	return p.repr.start_id
 }
 
-func (p iPremultipliedByteClass) IsValid(id stateID) bool {
+func (p *iPremultipliedByteClass) IsValid(id stateID) bool {
 	return (int(id) / p.repr.alphabetLen()) < p.repr.state_count
 }
 
-func (p iPremultipliedByteClass) IsMatchState(id stateID) bool {
+func (p *iPremultipliedByteClass) IsMatchState(id stateID) bool {
 	return p.repr.isMatchState(id)
 }
 
-func (p iPremultipliedByteClass) IsMatchOrDeadState(id stateID) bool {
+func (p *iPremultipliedByteClass) IsMatchOrDeadState(id stateID) bool {
 	return p.repr.isMatchStateOrDeadState(id)
 }
 
-func (p iPremultipliedByteClass) GetMatch(id stateID, match_index int, end int) *Match {
+func (p *iPremultipliedByteClass) GetMatch(id stateID, match_index int, end int) (Match, bool) {
 	if id > p.repr.max_match {
-		return nil
+		return Match{}, false
 	}
 
 	m := p.repr.matches[int(id)/p.repr.alphabetLen()][match_index]
-	return &Match{
+	return Match{
 		pattern: m.PatternID,
 		len:     m.PatternLength,
 		end:     end,
-	}
+	}, true
 }
 
-func (p iPremultipliedByteClass) MatchCount(id stateID) int {
+func (p *iPremultipliedByteClass) MatchCount(id stateID) int {
 	o := int(id) / p.repr.alphabetLen()
 	return len(p.repr.matches[o])
 }
 
-func (p iPremultipliedByteClass) NextState(id stateID, b byte) stateID {
+func (p *iPremultipliedByteClass) NextState(id stateID, b byte) stateID {
 	input := p.repr.byte_classes.bytes[b]
 	o := int(id) + int(input)
 	return p.repr.trans[o]
 }
 
 //todo this leaks garbage
-func (p iPremultipliedByteClass) NextStateNoFail(id stateID, b byte) stateID {
+func (p *iPremultipliedByteClass) NextStateNoFail(id stateID, b byte) stateID {
 	next := p.NextState(id, b)
 	if next == failedStateID {
 		panic("automaton should never return fail_id for next state")
@@ -296,104 +296,104 @@ func (p iPremultipliedByteClass) NextStateNoFail(id stateID, b byte) stateID {
 	return next
 }
 
-func (p iPremultipliedByteClass) StandardFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) *Match {
-	return standardFindAt(&p, prefilterState, bytes, i, id)
+func (p *iPremultipliedByteClass) StandardFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) (Match, bool) {
+	return standardFindAt(p, prefilterState, bytes, i, id)
 }
 
-func (p iPremultipliedByteClass) StandardFindAtImp(prefilterState *prefilterState, prefilter prefilter, bytes []byte, i int, id *stateID) *Match {
-	return standardFindAtImp(&p, prefilterState, prefilter, bytes, i, id)
+func (p *iPremultipliedByteClass) StandardFindAtImp(prefilterState *prefilterState, prefilter prefilter, bytes []byte, i int, id *stateID) (Match, bool) {
+	return standardFindAtImp(p, prefilterState, prefilter, bytes, i, id)
 }
 
-func (p iPremultipliedByteClass) LeftmostFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) *Match {
-	return leftmostFindAt(&p, prefilterState, bytes, i, id)
+func (p *iPremultipliedByteClass) LeftmostFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) (Match, bool) {
+	return leftmostFindAt(p, prefilterState, bytes, i, id)
 }
 
-func (p iPremultipliedByteClass) LeftmostFindAtImp(prefilterState *prefilterState, prefilter prefilter, bytes []byte, i int, id *stateID) *Match {
-	return leftmostFindAtImp(&p, prefilterState, prefilter, bytes, i, id)
+func (p *iPremultipliedByteClass) LeftmostFindAtImp(prefilterState *prefilterState, prefilter prefilter, bytes []byte, i int, id *stateID) (Match, bool) {
+	return leftmostFindAtImp(p, prefilterState, prefilter, bytes, i, id)
 }
 
-func (p iPremultipliedByteClass) LeftmostFindAtNoState(prefilterState *prefilterState, bytes []byte, i int) *Match {
-	return leftmostFindAtNoState(&p, prefilterState, bytes, i)
+func (p *iPremultipliedByteClass) LeftmostFindAtNoState(prefilterState *prefilterState, bytes []byte, i int) (Match, bool) {
+	return leftmostFindAtNoState(p, prefilterState, bytes, i)
 }
 
-func (p iPremultipliedByteClass) LeftmostFindAtNoStateImp(prefilterState *prefilterState, prefilter prefilter, bytes []byte, i int) *Match {
-	return leftmostFindAtNoStateImp(&p, prefilterState, prefilter, bytes, i)
+func (p *iPremultipliedByteClass) LeftmostFindAtNoStateImp(prefilterState *prefilterState, prefilter prefilter, bytes []byte, i int) (Match, bool) {
+	return leftmostFindAtNoStateImp(p, prefilterState, prefilter, bytes, i)
 }
 
-func (p iPremultipliedByteClass) OverlappingFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID, i2 *int) *Match {
-	return overlappingFindAt(&p, prefilterState, bytes, i, id, i2)
+func (p *iPremultipliedByteClass) OverlappingFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID, i2 *int) (Match, bool) {
+	return overlappingFindAt(p, prefilterState, bytes, i, id, i2)
 }
 
-func (p iPremultipliedByteClass) EarliestFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) *Match {
-	return earliestFindAt(&p, prefilterState, bytes, i, id)
+func (p *iPremultipliedByteClass) EarliestFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) (Match, bool) {
+	return earliestFindAt(p, prefilterState, bytes, i, id)
 }
 
-func (p iPremultipliedByteClass) FindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) *Match {
-	return findAt(&p, prefilterState, bytes, i, id)
+func (p *iPremultipliedByteClass) FindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) (Match, bool) {
+	return findAt(p, prefilterState, bytes, i, id)
 }
 
 type iPremultiplied struct {
 	repr iRepr
 }
 
-func (p iPremultiplied) FindAtNoState(prefilterState *prefilterState, bytes []byte, i int) *Match {
+func (p *iPremultiplied) FindAtNoState(prefilterState *prefilterState, bytes []byte, i int) (Match, bool) {
 	return findAtNoState(p, prefilterState, bytes, i)
 }
 
-func (p iPremultiplied) Repr() *iRepr {
+func (p *iPremultiplied) Repr() *iRepr {
 	return &p.repr
 }
 
-func (p iPremultiplied) MatchKind() *matchKind {
+func (p *iPremultiplied) MatchKind() *matchKind {
 	return &p.repr.match_kind
 }
 
-func (p iPremultiplied) Anchored() bool {
+func (p *iPremultiplied) Anchored() bool {
 	return p.repr.anchored
 }
 
-func (p iPremultiplied) Prefilter() prefilter {
+func (p *iPremultiplied) Prefilter() prefilter {
 	return p.repr.prefilter
 }
 
-func (p iPremultiplied) StartState() stateID {
+func (p *iPremultiplied) StartState() stateID {
 	return p.repr.start_id
 }
 
-func (p iPremultiplied) IsValid(id stateID) bool {
+func (p *iPremultiplied) IsValid(id stateID) bool {
 	return int(id)/256 < p.repr.state_count
 }
 
-func (p iPremultiplied) IsMatchState(id stateID) bool {
+func (p *iPremultiplied) IsMatchState(id stateID) bool {
 	return p.repr.isMatchState(id)
 }
 
-func (p iPremultiplied) IsMatchOrDeadState(id stateID) bool {
+func (p *iPremultiplied) IsMatchOrDeadState(id stateID) bool {
 	return p.repr.isMatchStateOrDeadState(id)
 }
 
-func (p iPremultiplied) GetMatch(id stateID, match_index int, end int) *Match {
+func (p *iPremultiplied) GetMatch(id stateID, match_index int, end int) (Match, bool) {
 	if id > p.repr.max_match {
-		return nil
+		return Match{}, false
 	}
 	m := p.repr.matches[int(id)/256][match_index]
-	return &Match{
+	return Match{
 		pattern: m.PatternID,
 		len:     m.PatternLength,
 		end:     end,
-	}
+	}, true
 }
 
-func (p iPremultiplied) MatchCount(id stateID) int {
+func (p *iPremultiplied) MatchCount(id stateID) int {
 	return len(p.repr.matches[int(id)/256])
 }
 
-func (p iPremultiplied) NextState(id stateID, b byte) stateID {
+func (p *iPremultiplied) NextState(id stateID, b byte) stateID {
 	o := int(id) + int(b)
 	return p.repr.trans[o]
 }
 
-func (p iPremultiplied) NextStateNoFail(id stateID, b byte) stateID {
+func (p *iPremultiplied) NextStateNoFail(id stateID, b byte) stateID {
 	next := p.NextState(id, b)
 	if next == failedStateID {
 		panic("automaton should never return fail_id for next state")
@@ -401,40 +401,40 @@ func (p iPremultiplied) NextStateNoFail(id stateID, b byte) stateID {
 	return next
 }
 
-func (p iPremultiplied) StandardFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) *Match {
-	return standardFindAt(&p, prefilterState, bytes, i, id)
+func (p *iPremultiplied) StandardFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) (Match, bool) {
+	return standardFindAt(p, prefilterState, bytes, i, id)
 }
 
-func (p iPremultiplied) StandardFindAtImp(prefilterState *prefilterState, prefilter prefilter, bytes []byte, i int, id *stateID) *Match {
-	return standardFindAtImp(&p, prefilterState, prefilter, bytes, i, id)
+func (p *iPremultiplied) StandardFindAtImp(prefilterState *prefilterState, prefilter prefilter, bytes []byte, i int, id *stateID) (Match, bool) {
+	return standardFindAtImp(p, prefilterState, prefilter, bytes, i, id)
 }
 
-func (p iPremultiplied) LeftmostFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) *Match {
-	return leftmostFindAt(&p, prefilterState, bytes, i, id)
+func (p *iPremultiplied) LeftmostFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) (Match, bool) {
+	return leftmostFindAt(p, prefilterState, bytes, i, id)
 }
 
-func (p iPremultiplied) LeftmostFindAtImp(prefilterState *prefilterState, prefilter prefilter, bytes []byte, i int, id *stateID) *Match {
-	return leftmostFindAtImp(&p, prefilterState, prefilter, bytes, i, id)
+func (p *iPremultiplied) LeftmostFindAtImp(prefilterState *prefilterState, prefilter prefilter, bytes []byte, i int, id *stateID) (Match, bool) {
+	return leftmostFindAtImp(p, prefilterState, prefilter, bytes, i, id)
 }
 
-func (p iPremultiplied) LeftmostFindAtNoState(prefilterState *prefilterState, bytes []byte, i int) *Match {
-	return leftmostFindAtNoState(&p, prefilterState, bytes, i)
+func (p *iPremultiplied) LeftmostFindAtNoState(prefilterState *prefilterState, bytes []byte, i int) (Match, bool) {
+	return leftmostFindAtNoState(p, prefilterState, bytes, i)
 }
 
-func (p iPremultiplied) LeftmostFindAtNoStateImp(prefilterState *prefilterState, prefilter prefilter, bytes []byte, i int) *Match {
-	return leftmostFindAtNoStateImp(&p, prefilterState, prefilter, bytes, i)
+func (p *iPremultiplied) LeftmostFindAtNoStateImp(prefilterState *prefilterState, prefilter prefilter, bytes []byte, i int) (Match, bool) {
+	return leftmostFindAtNoStateImp(p, prefilterState, prefilter, bytes, i)
 }
 
-func (p iPremultiplied) OverlappingFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID, i2 *int) *Match {
-	return overlappingFindAt(&p, prefilterState, bytes, i, id, i2)
+func (p *iPremultiplied) OverlappingFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID, i2 *int) (Match, bool) {
+	return overlappingFindAt(p, prefilterState, bytes, i, id, i2)
 }
 
-func (p iPremultiplied) EarliestFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) *Match {
-	return earliestFindAt(&p, prefilterState, bytes, i, id)
+func (p *iPremultiplied) EarliestFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) (Match, bool) {
+	return earliestFindAt(p, prefilterState, bytes, i, id)
 }
 
-func (p iPremultiplied) FindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) *Match {
-	return findAt(&p, prefilterState, bytes, i, id)
+func (p *iPremultiplied) FindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) (Match, bool) {
+	return findAt(p, prefilterState, bytes, i, id)
 }
 
 func nfaNextStateMemoized(nfa *iNFA, dfa *iRepr, populating stateID, current stateID, input byte) stateID {
@@ -463,11 +463,11 @@ type iStandard struct {
 	repr iRepr
 }
 
-func (p iStandard) FindAtNoState(prefilterState *prefilterState, bytes []byte, i int) *Match {
-	return findAtNoState(&p, prefilterState, bytes, i)
+func (p *iStandard) FindAtNoState(prefilterState *prefilterState, bytes []byte, i int) (Match, bool) {
+	return findAtNoState(p, prefilterState, bytes, i)
 }
 
-func (p iStandard) Repr() *iRepr {
+func (p *iStandard) Repr() *iRepr {
 	return &p.repr
 }
 
@@ -499,7 +499,7 @@ func (s *iStandard) IsMatchOrDeadState(id stateID) bool {
 	return s.repr.isMatchStateOrDeadState(id)
 }
 
-func (s *iStandard) GetMatch(id stateID, match_index int, end int) *Match {
+func (s *iStandard) GetMatch(id stateID, match_index int, end int) (Match, bool) {
 	return s.repr.GetMatch(id, match_index, end)
 }
 
@@ -520,39 +520,39 @@ func (s *iStandard) NextStateNoFail(id stateID, b byte) stateID {
 	return next
 }
 
-func (s *iStandard) StandardFindAt(state *prefilterState, bytes []byte, i int, id *stateID) *Match {
+func (s *iStandard) StandardFindAt(state *prefilterState, bytes []byte, i int, id *stateID) (Match, bool) {
 	return standardFindAt(s, state, bytes, i, id)
 }
 
-func (s *iStandard) StandardFindAtImp(state *prefilterState, prefilter prefilter, bytes []byte, i int, id *stateID) *Match {
+func (s *iStandard) StandardFindAtImp(state *prefilterState, prefilter prefilter, bytes []byte, i int, id *stateID) (Match, bool) {
 	return standardFindAtImp(s, state, prefilter, bytes, i, id)
 }
 
-func (s *iStandard) LeftmostFindAt(state *prefilterState, bytes []byte, i int, id *stateID) *Match {
+func (s *iStandard) LeftmostFindAt(state *prefilterState, bytes []byte, i int, id *stateID) (Match, bool) {
 	return leftmostFindAt(s, state, bytes, i, id)
 }
 
-func (s *iStandard) LeftmostFindAtImp(state *prefilterState, prefilter prefilter, bytes []byte, i int, id *stateID) *Match {
+func (s *iStandard) LeftmostFindAtImp(state *prefilterState, prefilter prefilter, bytes []byte, i int, id *stateID) (Match, bool) {
 	return leftmostFindAtImp(s, state, prefilter, bytes, i, id)
 }
 
-func (s *iStandard) LeftmostFindAtNoState(state *prefilterState, bytes []byte, i int) *Match {
+func (s *iStandard) LeftmostFindAtNoState(state *prefilterState, bytes []byte, i int) (Match, bool) {
 	return leftmostFindAtNoState(s, state, bytes, i)
 }
 
-func (s *iStandard) LeftmostFindAtNoStateImp(state *prefilterState, prefilter prefilter, bytes []byte, i int) *Match {
+func (s *iStandard) LeftmostFindAtNoStateImp(state *prefilterState, prefilter prefilter, bytes []byte, i int) (Match, bool) {
 	return leftmostFindAtNoStateImp(s, state, prefilter, bytes, i)
 }
 
-func (s *iStandard) OverlappingFindAt(state *prefilterState, bytes []byte, i int, id *stateID, i2 *int) *Match {
+func (s *iStandard) OverlappingFindAt(state *prefilterState, bytes []byte, i int, id *stateID, i2 *int) (Match, bool) {
 	return overlappingFindAt(s, state, bytes, i, id, i2)
 }
 
-func (s *iStandard) EarliestFindAt(state *prefilterState, bytes []byte, i int, id *stateID) *Match {
+func (s *iStandard) EarliestFindAt(state *prefilterState, bytes []byte, i int, id *stateID) (Match, bool) {
 	return earliestFindAt(s, state, bytes, i, id)
 }
 
-func (s *iStandard) FindAt(state *prefilterState, bytes []byte, i int, id *stateID) *Match {
+func (s *iStandard) FindAt(state *prefilterState, bytes []byte, i int, id *stateID) (Match, bool) {
 	return findAt(s, state, bytes, i, id)
 }
 
@@ -617,25 +617,25 @@ func (r *iRepr) isMatchStateOrDeadState(id stateID) bool {
 	return id <= r.max_match
 }
 
-func (r *iRepr) GetMatch(id stateID, match_index int, end int) *Match {
+func (r *iRepr) GetMatch(id stateID, match_index int, end int) (Match, bool) {
 	i := int(id)
 	if id > r.max_match {
-		return nil
+		return Match{}, false
 	}
 	if i > len(r.matches) {
-		return nil
+		return Match{}, false
 	}
 	matches := r.matches[int(id)]
 	if match_index > len(matches) {
-		return nil
+		return Match{}, false
 	}
 	pattern := matches[match_index]
 
-	return &Match{
+	return Match{
 		pattern: pattern.PatternID,
 		len:     pattern.PatternLength,
 		end:     end,
-	}
+	}, true
 }
 
 func (r *iRepr) MatchCount(id stateID) int {
@@ -0,0 +1,266 @@
+package aho_corasick
+
+import (
+	"sort"
+	"sync"
+)
+
+// a segment of a StandardMatch DynamicAhoCorasick is built again, once more than dynamicMinDead of its patterns
+// and more than 1/dynamicDeadRatio of them were removed
+const (
+	dynamicMinDead   = 32
+	dynamicDeadRatio = 8
+)
+
+// segment is an automaton over some of the patterns of a DynamicAhoCorasick, with their ids in ascending order.
+// Patterns removed from it are marked dead, indexed like the ids, until it is built again
+type segment struct {
+	ac        AhoCorasick
+	ids       []int
+	dead      []bool
+	deadCount int
+}
+
+// DynamicAhoCorasick is a set of patterns that can change without building the whole automaton again.
+// The patterns are kept in segments, automatons that get smaller from the oldest patterns to the newest.
+// Add builds a segment of the new pattern and merges it with the newest ones, while they have no more patterns,
+// so a pattern is built again a logarithmic number of times.
+// Remove builds the segment of the pattern again. For StandardMatch, searches skip removed patterns instead,
+// until enough of them add up in a segment.
+// Searches combine all segments, so they find what a single automaton built from the current patterns, in the order of their ids, would find.
+// It is safe for concurrent use, a search sees the patterns as they were when it started
+type DynamicAhoCorasick struct {
+	opts     Opts
+	mu       sync.RWMutex
+	patterns [][]byte
+	removed  []bool
+	segments []segment
+}
+
+// make sure the DynamicAhoCorasick implements the Finder interface
+var _ Finder = (*DynamicAhoCorasick)(nil)
+
+// NewDynamicAhoCorasick creates an empty DynamicAhoCorasick, whose automatons are built with Opts
+func NewDynamicAhoCorasick(o Opts) *DynamicAhoCorasick {
+	return &DynamicAhoCorasick{opts: o}
+}
+
+// Add adds a pattern and gives its id, ids are never reused
+func (d *DynamicAhoCorasick) Add(pattern string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	id := len(d.patterns)
+	d.patterns = append(d.patterns, []byte(pattern))
+	d.removed = append(d.removed, false)
+
+	ids := []int{id}
+	n := len(d.segments)
+	for n > 0 && len(ids) >= len(d.segments[n-1].ids)-d.segments[n-1].deadCount {
+		ids = append(d.liveIDs(d.segments[n-1]), ids...)
+		n -= 1
+	}
+
+	// searches may still use the old segments, so they are copied
+	segments := make([]segment, n, n+1)
+	copy(segments, d.segments)
+	d.segments = append(segments, d.build(ids))
+	return id
+}
+
+// Remove removes the pattern with the id, it reports whether there was such a pattern
+func (d *DynamicAhoCorasick) Remove(id int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if id < 0 || id >= len(d.patterns) || d.removed[id] {
+		return false
+	}
+	d.removed[id] = true
+	d.patterns[id] = nil
+
+	i := sort.Search(len(d.segments), func(i int) bool {
+		ids := d.segments[i].ids
+		return ids[len(ids)-1] >= id
+	})
+	s := d.segments[i]
+	segments := make([]segment, len(d.segments))
+	copy(segments, d.segments)
+	d.segments = segments
+
+	// a leftmost automaton would give the match of a removed pattern instead of another one, which can't be recovered
+	if d.opts.MatchKind == StandardMatch {
+		dead := make([]bool, len(s.ids))
+		copy(dead, s.dead)
+		dead[sort.SearchInts(s.ids, id)] = true
+		s.dead = dead
+		s.deadCount += 1
+
+		if s.deadCount <= dynamicMinDead || s.deadCount*dynamicDeadRatio <= len(s.ids) {
+			d.segments[i] = s
+			return true
+		}
+	}
+
+	if live := d.liveIDs(s); len(live) > 0 {
+		d.segments[i] = d.build(live)
+	} else {
+		d.segments = append(d.segments[:i], d.segments[i+1:]...)
+	}
+	return true
+}
+
+// Compact builds a single automaton of all patterns
+func (d *DynamicAhoCorasick) Compact() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ids := make([]int, 0, len(d.patterns))
+	for id, removed := range d.removed {
+		if !removed {
+			ids = append(ids, id)
+		}
+	}
+	d.segments = nil
+	if len(ids) > 0 {
+		d.segments = []segment{d.build(ids)}
+	}
+}
+
+func (d *DynamicAhoCorasick) build(ids []int) segment {
+	patterns := make([][]byte, len(ids))
+	for i, id := range ids {
+		patterns[i] = d.patterns[id]
+	}
+	builder := NewAhoCorasickBuilder(d.opts)
+	return segment{ac: builder.BuildByte(patterns), ids: ids}
+}
+
+// liveIDs gives the ids of the segment, which weren't removed
+func (d *DynamicAhoCorasick) liveIDs(s segment) []int {
+	ids := make([]int, 0, len(s.ids)-s.deadCount)
+	for _, id := range s.ids {
+		if !d.removed[id] {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// PatternCount gives the number of ids handed out, removed patterns included
+func (d *DynamicAhoCorasick) PatternCount() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return len(d.patterns)
+}
+
+// FindAll returns the matches found in the haystack, like AhoCorasick.FindAll.
+// The patterns of the matches are the ids Add gave
+func (d *DynamicAhoCorasick) FindAll(haystack string) []Match {
+	d.mu.RLock()
+	segments := d.segments
+	d.mu.RUnlock()
+
+	matches := make([]Match, 0)
+	if len(segments) == 0 {
+		return matches
+	}
+
+	hay := []byte(haystack)
+	searches := make([]segmentSearch, len(segments))
+	for i, s := range segments {
+		searches[i] = segmentSearch{segment: s, prestate: s.ac.newPrefilterState()}
+	}
+	kind := d.opts.MatchKind
+
+	for pos := 0; pos <= len(hay); {
+		var best Match
+		found := false
+		for i := range searches {
+			m, ok := searches[i].find(hay, pos)
+			if ok && (!found || dynamicIsBetter(kind, m, best)) {
+				best, found = m, true
+			}
+		}
+		if !found {
+			break
+		}
+
+		pos = best.Start() + 1
+
+		if d.opts.MatchOnlyWholeWords && !isWholeWord(hay, best) {
+			continue
+		}
+		matches = append(matches, best)
+	}
+	return matches
+}
+
+// dynamicIsBetter tells whether `m` is the match a single automaton would give instead of `best`.
+// Both are the first match of their segment, so the one that starts first wins for the leftmost kinds and the one that ends first otherwise.
+// On a tie, the longer match wins for all but LeftMostFirstMatch, then the lower id
+func dynamicIsBetter(kind matchKind, m, best Match) bool {
+	if kind == StandardMatch && m.End() != best.End() {
+		return m.End() < best.End()
+	}
+	if kind != StandardMatch && m.Start() != best.Start() {
+		return m.Start() < best.Start()
+	}
+	if kind != LeftMostFirstMatch && m.len != best.len {
+		return m.len > best.len
+	}
+	return m.pattern < best.pattern
+}
+
+// segmentSearch searches a segment, it keeps the match it found last for as long as it is still the first one
+type segmentSearch struct {
+	segment
+	prestate prefilterState
+	cached   Match
+	cachedOk bool
+	done     bool
+}
+
+// find gives the first match of the segment at or after `pos`, with the id of its pattern
+func (s *segmentSearch) find(haystack []byte, pos int) (Match, bool) {
+	if s.done {
+		return Match{}, false
+	}
+	if s.cachedOk && s.cached.Start() >= pos {
+		return s.cached, true
+	}
+
+	m, ok := s.ac.i.FindAtNoState(&s.prestate, haystack, pos)
+	if ok && s.deadCount > 0 && s.dead[m.pattern] {
+		m, ok = s.findLive(haystack, pos)
+	}
+	if !ok {
+		s.done = true
+		return Match{}, false
+	}
+	m.pattern = s.ids[m.pattern]
+	s.cached, s.cachedOk = m, true
+	return m, true
+}
+
+// findLive gives the match the StandardMatch segment would give at `pos` without its dead patterns.
+// It looks at the overlapping matches, up to those ending where the first live one does
+func (s *segmentSearch) findLive(haystack []byte, pos int) (Match, bool) {
+	prestate := s.ac.newPrefilterState()
+	iter := newOverlappingIter(s.ac, &prestate, haystack)
+	iter.pos = pos
+	iter.matchOnlyWholeWords = false
+
+	var best Match
+	found := false
+	for o, ok := iter.next(); ok; o, ok = iter.next() {
+		if found && o.End() > best.End() {
+			break
+		}
+		if !s.dead[o.pattern] && (!found || dynamicIsBetter(StandardMatch, o, best)) {
+			best, found = o, true
+		}
+	}
+	return best, found
+}
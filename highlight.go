@@ -0,0 +1,203 @@
+package aho_corasick
+
+import (
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Segment is a part of the haystack, which is covered by matches
+type Segment struct {
+	Start    int   `json:"start"`
+	End      int   `json:"end"`
+	Patterns []int `json:"patterns"`
+}
+
+// Highlighter marks the matches found in a haystack.
+// A StandardMatch automaton gives all overlapping matches, the leftmost match kinds give the matches FindAll returns.
+// Matches that overlap are either merged into a single segment, or nested:
+// the haystack is then split wherever a match starts or ends, so every segment lists the patterns of all matches covering it.
+// Empty matches cover nothing and are not highlighted
+type Highlighter struct {
+	ac    AhoCorasick
+	merge bool
+}
+
+// NewHighlighter gives a Highlighter, which merges overlapping matches if `merge` is true and nests them otherwise
+func NewHighlighter(ac AhoCorasick, merge bool) Highlighter {
+	return Highlighter{ac: ac, merge: merge}
+}
+
+// the colors of the ANSI output, picked by the lowest pattern of a segment
+var ansiColors = []string{"\x1b[31m", "\x1b[32m", "\x1b[33m", "\x1b[34m", "\x1b[35m", "\x1b[36m"}
+
+const (
+	ansiNested = "\x1b[4m"
+	ansiReset  = "\x1b[0m"
+)
+
+// Segments gives the segments of the haystack that are covered by matches, ordered and without overlaps.
+// The patterns of a segment are in ascending order
+func (h Highlighter) Segments(haystack []byte) []Segment {
+	var matches []Match
+	if h.ac.matchKind == StandardMatch {
+		prestate := h.ac.newPrefilterState()
+		iter := newOverlappingIter(h.ac, &prestate, haystack)
+		for m, ok := iter.next(); ok; m, ok = iter.next() {
+			matches = append(matches, m)
+		}
+	} else {
+		matches = h.ac.AppendMatches(nil, haystack)
+	}
+
+	if h.merge {
+		return mergeSegments(matches)
+	}
+	return nestSegments(matches)
+}
+
+// HTML gives the haystack as escaped HTML, with every segment in a <mark> element.
+// Its data-patterns attribute lists the patterns of the segment, separated by spaces
+func (h Highlighter) HTML(haystack []byte) string {
+	var b strings.Builder
+	h.write(&b, haystack, func(text []byte) {
+		b.WriteString(html.EscapeString(string(text)))
+	}, func(segment Segment) {
+		b.WriteString(`<mark data-patterns="`)
+		for i, pattern := range segment.Patterns {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(strconv.Itoa(pattern))
+		}
+		b.WriteString(`">`)
+		b.WriteString(html.EscapeString(string(haystack[segment.Start:segment.End])))
+		b.WriteString(`</mark>`)
+	})
+	return b.String()
+}
+
+// ANSI gives the haystack for a terminal, with every segment colored by its lowest pattern.
+// Segments covered by more than one match are underlined as well
+func (h Highlighter) ANSI(haystack []byte) string {
+	var b strings.Builder
+	h.write(&b, haystack, func(text []byte) {
+		b.Write(text)
+	}, func(segment Segment) {
+		b.WriteString(ansiColors[segment.Patterns[0]%len(ansiColors)])
+		if len(segment.Patterns) > 1 {
+			b.WriteString(ansiNested)
+		}
+		b.Write(haystack[segment.Start:segment.End])
+		b.WriteString(ansiReset)
+	})
+	return b.String()
+}
+
+// write calls `text` with the parts of the haystack outside of segments and `mark` with the segments, in order
+func (h Highlighter) write(b *strings.Builder, haystack []byte, text func([]byte), mark func(Segment)) {
+	b.Grow(len(haystack))
+	pos := 0
+	for _, segment := range h.Segments(haystack) {
+		text(haystack[pos:segment.Start])
+		mark(segment)
+		pos = segment.End
+	}
+	text(haystack[pos:])
+}
+
+// mergeSegments gives a segment for every group of matches that overlap each other
+func mergeSegments(matches []Match) []Segment {
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Start() < matches[j].Start()
+	})
+
+	segments := make([]Segment, 0)
+	for _, m := range matches {
+		if m.len == 0 {
+			continue
+		}
+		if n := len(segments); n > 0 && m.Start() < segments[n-1].End {
+			last := &segments[n-1]
+			if m.End() > last.End {
+				last.End = m.End()
+			}
+			last.Patterns = insertPattern(last.Patterns, m.pattern)
+			continue
+		}
+		segments = append(segments, Segment{Start: m.Start(), End: m.End(), Patterns: []int{m.pattern}})
+	}
+	return segments
+}
+
+// nestSegments splits the matches wherever one of them starts or ends.
+// Neighbouring parts that are covered by the same patterns form a single segment
+func nestSegments(matches []Match) []Segment {
+	type event struct {
+		pos, pattern, delta int
+	}
+	events := make([]event, 0, 2*len(matches))
+	for _, m := range matches {
+		if m.len == 0 {
+			continue
+		}
+		events = append(events, event{m.Start(), m.pattern, 1}, event{m.End(), m.pattern, -1})
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].pos < events[j].pos
+	})
+
+	segments := make([]Segment, 0)
+	active := make(map[int]int)
+	for i := 0; i < len(events); {
+		pos := events[i].pos
+		for ; i < len(events) && events[i].pos == pos; i++ {
+			active[events[i].pattern] += events[i].delta
+			if active[events[i].pattern] == 0 {
+				delete(active, events[i].pattern)
+			}
+		}
+		if len(active) == 0 || i == len(events) {
+			continue
+		}
+
+		patterns := make([]int, 0, len(active))
+		for pattern := range active {
+			patterns = append(patterns, pattern)
+		}
+		sort.Ints(patterns)
+
+		end := events[i].pos
+		if n := len(segments); n > 0 && segments[n-1].End == pos && equalPatterns(segments[n-1].Patterns, patterns) {
+			segments[n-1].End = end
+			continue
+		}
+		segments = append(segments, Segment{Start: pos, End: end, Patterns: patterns})
+	}
+	return segments
+}
+
+// insertPattern adds the pattern to the ascending `patterns`, unless it is there already
+func insertPattern(patterns []int, pattern int) []int {
+	i := sort.SearchInts(patterns, pattern)
+	if i < len(patterns) && patterns[i] == pattern {
+		return patterns
+	}
+	patterns = append(patterns, 0)
+	copy(patterns[i+1:], patterns[i:])
+	patterns[i] = pattern
+	return patterns
+}
+
+func equalPatterns(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
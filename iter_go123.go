@@ -0,0 +1,60 @@
+//go:build go1.23
+// +build go1.23
+
+package aho_corasick
+
+import "iter"
+
+// All gives the matches found in the haystack, the same FindAll returns, for use in range loops.
+// The search stops as soon as the loop does
+func (ac AhoCorasick) All(haystack []byte) iter.Seq[Match] {
+	return func(yield func(Match) bool) {
+		prestate := ac.newPrefilterState()
+		it := newFindIter(ac, &prestate, haystack)
+
+		for m, ok := it.next(); ok; m, ok = it.next() {
+			if !yield(m) {
+				return
+			}
+		}
+	}
+}
+
+// AllIndexed is All, with the index of every match
+func (ac AhoCorasick) AllIndexed(haystack []byte) iter.Seq2[int, Match] {
+	return indexed(ac.All(haystack))
+}
+
+// Overlapping gives the overlapping matches found in the haystack, the same IterOverlappingByte does, for use in range loops.
+// It panics for the leftmost match kinds, unless the automaton was built with Opts.Overlapping
+func (ac AhoCorasick) Overlapping(haystack []byte) iter.Seq[Match] {
+	ac = ac.overlapping()
+
+	return func(yield func(Match) bool) {
+		prestate := ac.newPrefilterState()
+		it := newOverlappingIter(ac, &prestate, haystack)
+
+		for m, ok := it.next(); ok; m, ok = it.next() {
+			if !yield(m) {
+				return
+			}
+		}
+	}
+}
+
+// OverlappingIndexed is Overlapping, with the index of every match
+func (ac AhoCorasick) OverlappingIndexed(haystack []byte) iter.Seq2[int, Match] {
+	return indexed(ac.Overlapping(haystack))
+}
+
+func indexed(seq iter.Seq[Match]) iter.Seq2[int, Match] {
+	return func(yield func(int, Match) bool) {
+		i := 0
+		for m := range seq {
+			if !yield(i, m) {
+				return
+			}
+			i++
+		}
+	}
+}
@@ -0,0 +1,78 @@
+//go:build go1.23
+// +build go1.23
+
+package aho_corasick
+
+import "testing"
+
+func TestAhoCorasick_All(t *testing.T) {
+	for _, t2 := range leftmostInsensitiveWholeWordTestCases {
+		builder := NewAhoCorasickBuilder(Opts{
+			AsciiCaseInsensitive: true,
+			MatchOnlyWholeWords:  true,
+			MatchKind:            LeftMostLongestMatch,
+		})
+		ac := builder.Build(t2.patterns)
+
+		var matches []Match
+		for i, m := range ac.AllIndexed([]byte(t2.haystack)) {
+			if i != len(matches) {
+				t.Errorf("expected index %v got %v", len(matches), i)
+			}
+			matches = append(matches, m)
+		}
+
+		if len(matches) != len(t2.matches) {
+			t.Fatalf("expected %v matches got %v", len(t2.matches), len(matches))
+		}
+		for i, m := range matches {
+			if m != t2.matches[i] {
+				t.Errorf("expected %v match got %v", t2.matches[i], m)
+			}
+		}
+
+		for m := range ac.All([]byte(t2.haystack)) {
+			if len(t2.matches) == 0 || m != t2.matches[0] {
+				t.Errorf("expected the first match %v got %v", t2.matches, m)
+			}
+			break
+		}
+	}
+}
+
+func TestAhoCorasick_Overlapping(t *testing.T) {
+	builder := NewAhoCorasickBuilder(Opts{MatchKind: StandardMatch})
+	ac := builder.Build([]string{"abc", "bc", "c", "abcd"})
+	haystack := []byte("xabcdabc")
+
+	var expected []Match
+	iter := ac.IterOverlappingByte(haystack)
+	for next := iter.Next(); next != nil; next = iter.Next() {
+		expected = append(expected, *next)
+	}
+
+	var first []Match
+	for i, m := range ac.OverlappingIndexed(haystack) {
+		if i == 3 {
+			break
+		}
+		first = append(first, m)
+	}
+
+	var matches []Match
+	for m := range ac.Overlapping(haystack) {
+		matches = append(matches, m)
+	}
+
+	if len(first) != 3 || len(matches) != len(expected) {
+		t.Fatalf("expected %v and the first 3 of them got %v and %v", expected, matches, first)
+	}
+	for i, m := range matches {
+		if m != expected[i] {
+			t.Errorf("expected %v match got %v", expected[i], m)
+		}
+		if i < len(first) && first[i] != expected[i] {
+			t.Errorf("expected %v match got %v", expected[i], first[i])
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package aho_corasick
+
+import "bytes"
+
+// LineMatch is a match, with the line it starts on
+type LineMatch struct {
+	Match
+	// Line is the number of the line, counting from 1
+	Line int
+	// Column is the byte offset of the match in its line, counting from 1
+	Column int
+	// LineStart and LineEnd are the offsets of the line in the haystack, the end excludes the newline
+	LineStart int
+	LineEnd   int
+}
+
+// LineIter tells the lines of the matches of an iterator.
+// Newlines are counted as the matches go, so every part of the haystack is looked at about once.
+// It works with the matches of Iter as well as IterOverlapping, whose starts may go back a little
+type LineIter struct {
+	iter      Iter
+	haystack  []byte
+	pos       int
+	line      int
+	lineStart int
+	lineEnd   int
+}
+
+// NewLineIter wraps an iterator over the haystack
+func NewLineIter(iter Iter, haystack []byte) *LineIter {
+	return &LineIter{iter: iter, haystack: haystack, line: 1, lineEnd: -1}
+}
+
+// Next gives the next match with its line, false if there are no more matches
+func (l *LineIter) Next() (LineMatch, bool) {
+	next := l.iter.Next()
+	if next == nil {
+		return LineMatch{}, false
+	}
+
+	l.seek(next.Start())
+	if l.lineEnd < 0 {
+		l.lineEnd = len(l.haystack)
+		if i := bytes.IndexByte(l.haystack[l.lineStart:], '\n'); i >= 0 {
+			l.lineEnd = l.lineStart + i
+		}
+	}
+
+	return LineMatch{
+		Match:     *next,
+		Line:      l.line,
+		Column:    next.Start() - l.lineStart + 1,
+		LineStart: l.lineStart,
+		LineEnd:   l.lineEnd,
+	}, true
+}
+
+// seek moves to `pos`, counting the newlines on the way
+func (l *LineIter) seek(pos int) {
+	if pos < l.lineStart {
+		l.line -= bytes.Count(l.haystack[pos:l.lineStart], []byte{'\n'})
+		l.lineStart = bytes.LastIndexByte(l.haystack[:pos], '\n') + 1
+		l.lineEnd = -1
+	}
+
+	for l.pos < pos {
+		i := bytes.IndexByte(l.haystack[l.pos:pos], '\n')
+		if i < 0 {
+			break
+		}
+		l.line += 1
+		l.lineStart = l.pos + i + 1
+		l.lineEnd = -1
+		l.pos = l.lineStart
+	}
+	l.pos = pos
+}
@@ -0,0 +1,156 @@
+package aho_corasick
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/bits"
+)
+
+// the scanning below works on 8 bytes at a time (SWAR, SIMD within a register).
+// every needle byte is broadcast to all the bytes of a word and xor'ed with the haystack word,
+// which turns matching bytes into zero bytes that can then be detected for the whole word at once.
+const (
+	swarWordLen        = 8
+	swarLo      uint64 = 0x0101010101010101
+	swarHi      uint64 = 0x8080808080808080
+)
+
+func swarBroadcast(b byte) uint64 {
+	return swarLo * uint64(b)
+}
+
+// swarZeroBytes sets the high bit of every zero byte in `x`.
+// Bytes above the first zero byte may be reported falsely because of the borrow,
+// the lowest set bit is always exact and that is the only one that is looked at
+func swarZeroBytes(x uint64) uint64 {
+	return (x - swarLo) &^ x & swarHi
+}
+
+// swarFirst gives the index of the first byte flagged in the mask.
+// The word is loaded as little endian, so the first byte in memory is the least significant one
+func swarFirst(mask uint64) int {
+	return bits.TrailingZeros64(mask) / 8
+}
+
+// memchr gives the index of the first occurrence of `b1` in the haystack or `noneCandidate`
+func memchr(b1 byte, haystack []byte) int {
+	return bytes.IndexByte(haystack, b1)
+}
+
+// memchr2 gives the index of the first occurrence of `b1` or `b2` in the haystack or `noneCandidate`
+func memchr2(b1, b2 byte, haystack []byte) int {
+	v1, v2 := swarBroadcast(b1), swarBroadcast(b2)
+	i := 0
+
+	for ; i+swarWordLen <= len(haystack); i += swarWordLen {
+		w := binary.LittleEndian.Uint64(haystack[i:])
+		mask := swarZeroBytes(w^v1) | swarZeroBytes(w^v2)
+		if mask != 0 {
+			return i + swarFirst(mask)
+		}
+	}
+
+	for ; i < len(haystack); i++ {
+		if b := haystack[i]; b == b1 || b == b2 {
+			return i
+		}
+	}
+	return noneCandidate
+}
+
+// memchr3 gives the index of the first occurrence of `b1`, `b2` or `b3` in the haystack or `noneCandidate`
+func memchr3(b1, b2, b3 byte, haystack []byte) int {
+	v1, v2, v3 := swarBroadcast(b1), swarBroadcast(b2), swarBroadcast(b3)
+	i := 0
+
+	for ; i+swarWordLen <= len(haystack); i += swarWordLen {
+		w := binary.LittleEndian.Uint64(haystack[i:])
+		mask := swarZeroBytes(w^v1) | swarZeroBytes(w^v2) | swarZeroBytes(w^v3)
+		if mask != 0 {
+			return i + swarFirst(mask)
+		}
+	}
+
+	for ; i < len(haystack); i++ {
+		if b := haystack[i]; b == b1 || b == b2 || b == b3 {
+			return i
+		}
+	}
+	return noneCandidate
+}
+
+// swarFoldMask gives the mask that maps both cases of `b` to its lower case, when or'ed with a word.
+// Or'ing 0x20 into a byte maps exactly the upper and lower case of a letter to the lower case,
+// for bytes that are not letters the mask is zero and the comparison is exact
+func swarFoldMask(b byte) uint64 {
+	if 'a' <= b && b <= 'z' {
+		return swarBroadcast(asciiCaseMask)
+	}
+	return 0
+}
+
+// memchrFold is memchr, where `b1` also matches its upper case, if it's a lower case letter
+func memchrFold(b1 byte, haystack []byte) int {
+	v1 := swarBroadcast(b1)
+	f1 := swarFoldMask(b1)
+	i := 0
+
+	for ; i+swarWordLen <= len(haystack); i += swarWordLen {
+		w := binary.LittleEndian.Uint64(haystack[i:])
+		mask := swarZeroBytes((w | f1) ^ v1)
+		if mask != 0 {
+			return i + swarFirst(mask)
+		}
+	}
+
+	for ; i < len(haystack); i++ {
+		if b := haystack[i]; b|byte(f1) == b1 {
+			return i
+		}
+	}
+	return noneCandidate
+}
+
+// memchr2Fold is memchr2, where each lower case letter also matches its upper case
+func memchr2Fold(b1, b2 byte, haystack []byte) int {
+	v1, v2 := swarBroadcast(b1), swarBroadcast(b2)
+	f1, f2 := swarFoldMask(b1), swarFoldMask(b2)
+	i := 0
+
+	for ; i+swarWordLen <= len(haystack); i += swarWordLen {
+		w := binary.LittleEndian.Uint64(haystack[i:])
+		mask := swarZeroBytes((w|f1)^v1) | swarZeroBytes((w|f2)^v2)
+		if mask != 0 {
+			return i + swarFirst(mask)
+		}
+	}
+
+	for ; i < len(haystack); i++ {
+		if b := haystack[i]; b|byte(f1) == b1 || b|byte(f2) == b2 {
+			return i
+		}
+	}
+	return noneCandidate
+}
+
+// memchr3Fold is memchr3, where each lower case letter also matches its upper case
+func memchr3Fold(b1, b2, b3 byte, haystack []byte) int {
+	v1, v2, v3 := swarBroadcast(b1), swarBroadcast(b2), swarBroadcast(b3)
+	f1, f2, f3 := swarFoldMask(b1), swarFoldMask(b2), swarFoldMask(b3)
+	i := 0
+
+	for ; i+swarWordLen <= len(haystack); i += swarWordLen {
+		w := binary.LittleEndian.Uint64(haystack[i:])
+		mask := swarZeroBytes((w|f1)^v1) | swarZeroBytes((w|f2)^v2) | swarZeroBytes((w|f3)^v3)
+		if mask != 0 {
+			return i + swarFirst(mask)
+		}
+	}
+
+	for ; i < len(haystack); i++ {
+		if b := haystack[i]; b|byte(f1) == b1 || b|byte(f2) == b2 || b|byte(f3) == b3 {
+			return i
+		}
+	}
+	return noneCandidate
+}
@@ -17,7 +17,7 @@ type iNFA struct {
 	states        []state
 }
 
-func (n *iNFA) FindAtNoState(prefilterState *prefilterState, bytes []byte, i int) *Match {
+func (n *iNFA) FindAtNoState(prefilterState *prefilterState, bytes []byte, i int) (Match, bool) {
 	return findAtNoState(n, prefilterState, bytes, i)
 }
 
@@ -76,39 +76,39 @@ func (n *iNFA) NextStateNoFail(id stateID, b byte) stateID {
 	return next
 }
 
-func (n *iNFA) StandardFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) *Match {
+func (n *iNFA) StandardFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) (Match, bool) {
 	return standardFindAt(n, prefilterState, bytes, i, id)
 }
 
-func (n *iNFA) StandardFindAtImp(prefilterState *prefilterState, prefilter prefilter, bytes []byte, i int, id *stateID) *Match {
+func (n *iNFA) StandardFindAtImp(prefilterState *prefilterState, prefilter prefilter, bytes []byte, i int, id *stateID) (Match, bool) {
 	return standardFindAtImp(n, prefilterState, prefilter, bytes, i, id)
 }
 
-func (n *iNFA) LeftmostFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) *Match {
+func (n *iNFA) LeftmostFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) (Match, bool) {
 	return leftmostFindAt(n, prefilterState, bytes, i, id)
 }
 
-func (n *iNFA) LeftmostFindAtImp(prefilterState *prefilterState, prefilter prefilter, bytes []byte, i int, id *stateID) *Match {
+func (n *iNFA) LeftmostFindAtImp(prefilterState *prefilterState, prefilter prefilter, bytes []byte, i int, id *stateID) (Match, bool) {
 	return leftmostFindAtImp(n, prefilterState, prefilter, bytes, i, id)
 }
 
-func (n *iNFA) LeftmostFindAtNoState(prefilterState *prefilterState, bytes []byte, i int) *Match {
+func (n *iNFA) LeftmostFindAtNoState(prefilterState *prefilterState, bytes []byte, i int) (Match, bool) {
 	return leftmostFindAtNoState(n, prefilterState, bytes, i)
 }
 
-func (n *iNFA) LeftmostFindAtNoStateImp(prefilterState *prefilterState, prefilter prefilter, bytes []byte, i int) *Match {
+func (n *iNFA) LeftmostFindAtNoStateImp(prefilterState *prefilterState, prefilter prefilter, bytes []byte, i int) (Match, bool) {
 	return leftmostFindAtNoStateImp(n, prefilterState, prefilter, bytes, i)
 }
 
-func (n *iNFA) OverlappingFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID, i2 *int) *Match {
+func (n *iNFA) OverlappingFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID, i2 *int) (Match, bool) {
 	return overlappingFindAt(n, prefilterState, bytes, i, id, i2)
 }
 
-func (n *iNFA) EarliestFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) *Match {
+func (n *iNFA) EarliestFindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) (Match, bool) {
 	return earliestFindAt(n, prefilterState, bytes, i, id)
 }
 
-func (n *iNFA) FindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) *Match {
+func (n *iNFA) FindAt(prefilterState *prefilterState, bytes []byte, i int, id *stateID) (Match, bool) {
 	return findAt(n, prefilterState, bytes, i, id)
 }
 
@@ -128,20 +128,20 @@ func (n *iNFA) UsePrefilter() bool {
 	return !p.LooksForNonStartOfMatch()
 }
 
-func (n *iNFA) GetMatch(id stateID, matchIndex int, end int) *Match {
+func (n *iNFA) GetMatch(id stateID, matchIndex int, end int) (Match, bool) {
 	if int(id) >= len(n.states) {
-		return nil
+		return Match{}, false
 	}
 	state := n.states[id]
 	if matchIndex >= len(state.matches) {
-		return nil
+		return Match{}, false
 	}
 	pat := state.matches[matchIndex]
-	return &Match{
+	return Match{
 		pattern: pat.PatternID,
 		len:     pat.PatternLength,
 		end:     end,
-	}
+	}, true
 }
 
 func (n *iNFA) addDenseState(depth int) stateID {
@@ -331,7 +331,9 @@ func (c *compiler) fillFailureTransitionsLeftmost() {
 				queue = append(queue, next)
 				seen.insert(next.id)
 			}
-			if c.nfa.state(nextId).isMatch() {
+			// the failure transition of a state after the start state leads back to it, which must not be followed
+			// once a match has been seen. That is the case if the state matches or the start state matches an empty pattern
+			if next.matchAtDepth != nil {
 				c.nfa.state(nextId).fail = deadStateID
 			}
 		}
@@ -585,6 +587,14 @@ func oppositeAsciiCase(b byte) byte {
 	return b
 }
 
+// asciiFold maps upper case letters to lower case and leaves every other byte as it is
+func asciiFold(b byte) byte {
+	if 'A' <= b && b <= 'Z' {
+		return toAsciiLowercase(b)
+	}
+	return b
+}
+
 func (c *compiler) addState(depth int) stateID {
 	if depth < c.builder.denseDepth {
 		return c.nfa.addDenseState(depth)
@@ -594,7 +604,7 @@ func (c *compiler) addState(depth int) stateID {
 }
 
 func newCompiler(builder iNFABuilder) compiler {
-	p := newPrefilterBuilder(builder.asciiCaseInsensitive)
+	p := newPrefilterBuilder(builder.asciiCaseInsensitive, builder.byteFrequencies)
 
 	return compiler{
 		builder:   builder,
@@ -620,6 +630,7 @@ type iNFABuilder struct {
 	prefilter            bool
 	anchored             bool
 	asciiCaseInsensitive bool
+	byteFrequencies      *[256]byte
 }
 
 func newNFABuilder(kind matchKind, asciiCaseInsensitive bool) *iNFABuilder {
@@ -629,6 +640,7 @@ func newNFABuilder(kind matchKind, asciiCaseInsensitive bool) *iNFABuilder {
 		prefilter:            true,
 		anchored:             false,
 		asciiCaseInsensitive: asciiCaseInsensitive,
+		byteFrequencies:      &byteFrequencies,
 	}
 }
 
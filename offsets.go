@@ -0,0 +1,69 @@
+package aho_corasick
+
+import (
+	"sort"
+	"unicode/utf8"
+)
+
+// Unit is what offsets into a haystack count
+type Unit int
+
+const (
+	// UnitByte counts bytes, the offsets of Match
+	UnitByte Unit = iota
+	// UnitRune counts runes, a byte that is not valid UTF-8 counts as a rune
+	UnitRune
+	// UnitUTF16 counts UTF-16 code units, as JavaScript strings do. Runes outside the basic multilingual plane count twice
+	UnitUTF16
+)
+
+// Offsets are the start and the end of a match, in a Unit
+type Offsets struct {
+	Start int
+	End   int
+}
+
+// ConvertOffsets gives the offsets of the matches in `unit`, in the order of the matches.
+// The haystack is decoded only once, whatever the order of the matches is.
+// An offset inside of a rune counts that rune
+func ConvertOffsets(haystack []byte, matches []Match, unit Unit) []Offsets {
+	offsets := make([]Offsets, len(matches))
+	if unit == UnitByte {
+		for i, m := range matches {
+			offsets[i] = Offsets{Start: m.Start(), End: m.End()}
+		}
+		return offsets
+	}
+
+	// every match has a boundary at its start and at its end, which are converted in ascending order
+	type boundary struct {
+		pos, match int
+		end        bool
+	}
+	boundaries := make([]boundary, 0, 2*len(matches))
+	for i, m := range matches {
+		boundaries = append(boundaries, boundary{m.Start(), i, false}, boundary{m.End(), i, true})
+	}
+	sort.Slice(boundaries, func(i, j int) bool {
+		return boundaries[i].pos < boundaries[j].pos
+	})
+
+	pos, units := 0, 0
+	for _, b := range boundaries {
+		for pos < b.pos {
+			r, size := utf8.DecodeRune(haystack[pos:])
+			units += 1
+			if unit == UnitUTF16 && r >= 0x10000 {
+				units += 1
+			}
+			pos += size
+		}
+
+		if b.end {
+			offsets[b.match].End = units
+		} else {
+			offsets[b.match].Start = units
+		}
+	}
+	return offsets
+}
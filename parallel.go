@@ -0,0 +1,123 @@
+package aho_corasick
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// parallelMinChunk is the smallest part of the haystack that is worth handing to a worker of FindAllParallel
+var parallelMinChunk = 64 * 1024
+
+// FindAllParallel returns the same matches as FindAll, but searches chunks of the haystack with `workers` goroutines.
+// If `workers` is not positive, GOMAXPROCS workers are used. Every worker gets at least 64KB
+func (ac AhoCorasick) FindAllParallel(haystack []byte, workers int) []Match {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if most := (len(haystack) + parallelMinChunk - 1) / parallelMinChunk; workers > most {
+		workers = most
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	// the last chunk also owns the empty matches at the end of the haystack
+	bounds := make([]int, workers+1)
+	for k := range bounds {
+		bounds[k] = len(haystack) * k / workers
+	}
+	bounds[workers] = len(haystack) + 1
+
+	chunks := make([][]Match, workers)
+	var wg sync.WaitGroup
+	for k := 0; k < workers; k++ {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			prestate := ac.newPrefilterState()
+			chunks[k] = ac.findChunk(&prestate, haystack, bounds[k], bounds[k+1])
+		}(k)
+	}
+	wg.Wait()
+
+	// a worker can't know where the search before its chunk resumes,
+	// so the sequential search runs from there until it reports a match of the worker
+	matches := make([]Match, 0)
+	at := 0
+
+	for k, chunk := range chunks {
+		lo, hi := bounds[k], bounds[k+1]
+		prestate := ac.newPrefilterState()
+
+		for {
+			if at == lo {
+				matches = append(matches, chunk...)
+				if len(chunk) > 0 {
+					at = chunk[len(chunk)-1].Start() + 1
+				} else {
+					at = hi
+				}
+				break
+			}
+
+			m, ok := findBefore(ac.i, &prestate, haystack, at, hi)
+			if !ok || m.Start() >= hi {
+				at = hi
+				break
+			}
+
+			// once the sequential search reports a match of the worker, it goes on exactly like the worker did
+			if i := sort.Search(len(chunk), func(i int) bool { return chunk[i].Start() >= m.Start() }); i < len(chunk) && chunk[i].Start() == m.Start() {
+				matches = append(matches, chunk[i:]...)
+				at = chunk[len(chunk)-1].Start() + 1
+				break
+			}
+
+			matches = append(matches, m)
+			at = m.Start() + 1
+		}
+	}
+
+	if !ac.matchOnlyWholeWords {
+		return matches
+	}
+
+	words := matches[:0]
+	for i := range matches {
+		if isWholeWord(haystack, matches[i]) {
+			words = append(words, matches[i])
+		}
+	}
+	return words
+}
+
+// findChunk gives the matches of a sequential search that starts at `lo`, until it reaches a match that starts at `hi` or later.
+// The matches are not filtered by MatchOnlyWholeWords
+func (ac AhoCorasick) findChunk(prestate *prefilterState, haystack []byte, lo, hi int) []Match {
+	var matches []Match
+
+	for at := lo; ; {
+		m, ok := findBefore(ac.i, prestate, haystack, at, hi)
+		if !ok || m.Start() >= hi {
+			break
+		}
+		matches = append(matches, m)
+		at = m.Start() + 1
+	}
+	return matches
+}
+
+// findBefore gives the match a search of the whole haystack at `at` would, if there is one that starts before `hi`.
+// Only the bytes a match starting before `hi` can reach are searched, so no match means there is none starting before `hi`.
+// A match that starts at `hi` or later may be reported as well, it only tells the same
+func findBefore(i imp, prestate *prefilterState, haystack []byte, at, hi int) (Match, bool) {
+	end := hi + i.MaxPatternLen() - 1
+	if end < len(haystack) {
+		haystack = haystack[:end]
+	}
+	if at > len(haystack) {
+		return Match{}, false
+	}
+	return i.FindAtNoState(prestate, haystack, at)
+}
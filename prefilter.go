@@ -8,15 +8,20 @@ type startBytesThree struct {
 	byte1 byte
 	byte2 byte
 	byte3 byte
+	fold  bool
 }
 
 func (s startBytesThree) NextCandidate(_ *prefilterState, haystack []byte, at int) int {
-	for i, b := range haystack[at:] {
-		if s.byte1 == b || s.byte2 == b || s.byte3 == b {
-			return at + i
-		}
+	var i int
+	if s.fold {
+		i = memchr3Fold(s.byte1, s.byte2, s.byte3, haystack[at:])
+	} else {
+		i = memchr3(s.byte1, s.byte2, s.byte3, haystack[at:])
+	}
+	if i == noneCandidate {
+		return noneCandidate
 	}
-	return noneCandidate
+	return at + i
 }
 
 func (s startBytesThree) HeapBytes() int {
@@ -42,15 +47,20 @@ func (s *startBytesThree) clone() prefilter {
 type startBytesTwo struct {
 	byte1 byte
 	byte2 byte
+	fold  bool
 }
 
 func (s startBytesTwo) NextCandidate(_ *prefilterState, haystack []byte, at int) int {
-	for i, b := range haystack[at:] {
-		if s.byte1 == b || s.byte2 == b {
-			return at + i
-		}
+	var i int
+	if s.fold {
+		i = memchr2Fold(s.byte1, s.byte2, haystack[at:])
+	} else {
+		i = memchr2(s.byte1, s.byte2, haystack[at:])
 	}
-	return noneCandidate
+	if i == noneCandidate {
+		return noneCandidate
+	}
+	return at + i
 }
 
 func (s startBytesTwo) HeapBytes() int {
@@ -75,15 +85,20 @@ func (s *startBytesTwo) clone() prefilter {
 
 type startBytesOne struct {
 	byte1 byte
+	fold  bool
 }
 
 func (s startBytesOne) NextCandidate(_ *prefilterState, haystack []byte, at int) int {
-	for i, b := range haystack[at:] {
-		if s.byte1 == b {
-			return at + i
-		}
+	var i int
+	if s.fold {
+		i = memchrFold(s.byte1, haystack[at:])
+	} else {
+		i = memchr(s.byte1, haystack[at:])
 	}
-	return noneCandidate
+	if i == noneCandidate {
+		return noneCandidate
+	}
+	return at + i
 }
 
 func (s startBytesOne) HeapBytes() int {
@@ -131,23 +146,41 @@ func (r *rareByteOffsets) set(b byte, off rareByteOffset) {
 	r.rbo[int(b)].max = m
 }
 
+// candidate gives the earliest position a match can start at, given a rare byte found at `pos`
+func (r *rareByteOffsets) candidate(state *prefilterState, haystack []byte, at, pos int) int {
+	state.updateAt(pos)
+	c := pos - int(r.rbo[haystack[pos]].max)
+	if c < 0 {
+		c = 0
+	}
+
+	if at > c {
+		c = at
+	}
+	return c
+}
+
 type prefilterBuilder struct {
 	count                int
+	empty                bool
 	asciiCaseInsensitive bool
 	startBytes           startBytesBuilder
 	rareBytes            rareBytesBuilder
+	packed               teddyBuilder
 }
 
 func (p *prefilterBuilder) build() prefilter {
+	// an empty pattern matches at every position, there is nothing to skip
+	if p.empty {
+		return nil
+	}
+
 	startBytes := p.startBytes.build()
 	rareBytes := p.rareBytes.build()
 
 	switch true {
 	case startBytes != nil && rareBytes != nil:
-		hasFewerBytes := p.startBytes.count < p.rareBytes.count
-
-		hasRarerBytes := p.startBytes.rankSum <= p.rareBytes.rankSum+50
-		if hasFewerBytes || hasRarerBytes {
+		if p.preferStartBytes() {
 			return startBytes
 		} else {
 			return rareBytes
@@ -156,30 +189,60 @@ func (p *prefilterBuilder) build() prefilter {
 		return startBytes
 	case rareBytes != nil:
 		return rareBytes
-	case p.asciiCaseInsensitive:
-		return nil
 	default:
-		return nil
+		if packed := p.packed.build(); packed != nil {
+			return packed
+		}
+		return p.buildSet()
 	}
 }
 
+func (p *prefilterBuilder) buildSet() prefilter {
+	startBytes := p.startBytes.buildSet()
+	rareBytes := p.rareBytes.buildSet()
+
+	switch true {
+	case startBytes != nil && rareBytes != nil:
+		if p.preferStartBytes() {
+			return startBytes
+		} else {
+			return rareBytes
+		}
+	case startBytes != nil:
+		return startBytes
+	default:
+		return rareBytes
+	}
+}
+
+func (p *prefilterBuilder) preferStartBytes() bool {
+	hasFewerBytes := p.startBytes.count < p.rareBytes.count
+
+	hasRarerBytes := p.startBytes.rankSum <= p.rareBytes.rankSum+50
+	return hasFewerBytes || hasRarerBytes
+}
+
 func (p *prefilterBuilder) add(bytes []byte) {
 	p.count += 1
+	p.empty = p.empty || len(bytes) == 0
 	p.startBytes.add(bytes)
 	p.rareBytes.add(bytes)
+	p.packed.add(bytes)
 }
 
-func newPrefilterBuilder(asciiCaseInsensitive bool) prefilterBuilder {
+func newPrefilterBuilder(asciiCaseInsensitive bool, frequencies *[256]byte) prefilterBuilder {
 	return prefilterBuilder{
 		count:                0,
 		asciiCaseInsensitive: asciiCaseInsensitive,
-		startBytes:           newStartBytesBuilder(asciiCaseInsensitive),
-		rareBytes:            newRareBytesBuilder(asciiCaseInsensitive),
+		startBytes:           newStartBytesBuilder(asciiCaseInsensitive, frequencies),
+		rareBytes:            newRareBytesBuilder(asciiCaseInsensitive, frequencies),
+		packed:               newTeddyBuilder(asciiCaseInsensitive),
 	}
 }
 
 type rareBytesBuilder struct {
 	asciiCaseInsensitive bool
+	frequencies          *[256]byte
 	rareSet              byteSet
 	byteOffsets          rareByteOffsets
 	available            bool
@@ -190,25 +253,30 @@ type rareBytesBuilder struct {
 type rareBytesOne struct {
 	byte1  byte
 	offset rareByteOffset
+	fold   bool
 }
 
 func (r rareBytesOne) NextCandidate(state *prefilterState, haystack []byte, at int) int {
-	for i, b := range haystack[at:] {
-		if r.byte1 == b {
-			pos := at + i
-			state.lastScanAt = pos
-			r := pos - int(r.offset.max)
-			if r < 0 {
-				r = 0
-			}
-
-			if at > r {
-				r = at
-			}
-			return r
-		}
+	var i int
+	if r.fold {
+		i = memchrFold(r.byte1, haystack[at:])
+	} else {
+		i = memchr(r.byte1, haystack[at:])
+	}
+	if i == noneCandidate {
+		return noneCandidate
+	}
+	pos := at + i
+	state.lastScanAt = pos
+	c := pos - int(r.offset.max)
+	if c < 0 {
+		c = 0
+	}
+
+	if at > c {
+		c = at
 	}
-	return noneCandidate
+	return c
 }
 
 func (r rareBytesOne) HeapBytes() int {
@@ -235,25 +303,20 @@ type rareBytesTwo struct {
 	offsets rareByteOffsets
 	byte1   byte
 	byte2   byte
+	fold    bool
 }
 
 func (r rareBytesTwo) NextCandidate(state *prefilterState, haystack []byte, at int) int {
-	for i, b := range haystack[at:] {
-		if r.byte1 == b || r.byte2 == b {
-			pos := at + i
-			state.updateAt(pos)
-			r := pos - int(r.offsets.rbo[haystack[pos]].max)
-			if r < 0 {
-				r = 0
-			}
-
-			if at > r {
-				r = at
-			}
-			return r
-		}
+	var i int
+	if r.fold {
+		i = memchr2Fold(r.byte1, r.byte2, haystack[at:])
+	} else {
+		i = memchr2(r.byte1, r.byte2, haystack[at:])
 	}
-	return noneCandidate
+	if i == noneCandidate {
+		return noneCandidate
+	}
+	return r.offsets.candidate(state, haystack, at, at+i)
 }
 
 func (r rareBytesTwo) HeapBytes() int {
@@ -281,25 +344,20 @@ type rareBytesThree struct {
 	byte1   byte
 	byte2   byte
 	byte3   byte
+	fold    bool
 }
 
 func (r rareBytesThree) NextCandidate(state *prefilterState, haystack []byte, at int) int {
-	for i, b := range haystack[at:] {
-		if r.byte1 == b || r.byte2 == b || r.byte3 == b {
-			pos := at + i
-			state.updateAt(pos)
-			r := pos - int(r.offsets.rbo[haystack[pos]].max)
-			if r < 0 {
-				r = 0
-			}
-
-			if at > r {
-				r = at
-			}
-			return r
-		}
+	var i int
+	if r.fold {
+		i = memchr3Fold(r.byte1, r.byte2, r.byte3, haystack[at:])
+	} else {
+		i = memchr3(r.byte1, r.byte2, r.byte3, haystack[at:])
+	}
+	if i == noneCandidate {
+		return noneCandidate
 	}
-	return noneCandidate
+	return r.offsets.candidate(state, haystack, at, at+i)
 }
 
 func (r rareBytesThree) HeapBytes() int {
@@ -343,12 +401,14 @@ func (r *rareBytesBuilder) build() prefilter {
 		return &rareBytesOne{
 			byte1:  bytes[0],
 			offset: r.byteOffsets.rbo[bytes[0]],
+			fold:   r.asciiCaseInsensitive,
 		}
 	case 2:
 		return &rareBytesTwo{
 			offsets: r.byteOffsets,
 			byte1:   bytes[0],
 			byte2:   bytes[1],
+			fold:    r.asciiCaseInsensitive,
 		}
 	case 3:
 		return &rareBytesThree{
@@ -356,6 +416,7 @@ func (r *rareBytesBuilder) build() prefilter {
 			byte1:   bytes[0],
 			byte2:   bytes[1],
 			byte3:   bytes[2],
+			fold:    r.asciiCaseInsensitive,
 		}
 	default:
 		return nil
@@ -367,7 +428,7 @@ func (r *rareBytesBuilder) add(bytes []byte) {
 		return
 	}
 
-	if r.count > 3 {
+	if r.count > byteSetMaxBytes {
 		r.available = false
 		return
 	}
@@ -381,7 +442,7 @@ func (r *rareBytesBuilder) add(bytes []byte) {
 		return
 	}
 
-	rarest1, rarest2 := bytes[0], freqRank(bytes[0])
+	rarest1, rarest2 := bytes[0], freqRank(r.frequencies, bytes[0])
 	found := false
 
 	for pos, b := range bytes {
@@ -389,33 +450,43 @@ func (r *rareBytesBuilder) add(bytes []byte) {
 		if found {
 			continue
 		}
-		if r.rareSet.contains(b) {
+		if r.rareSet.contains(r.fold(b)) {
 			found = true
+			continue
 		}
-		rank := freqRank(b)
+		rank := freqRank(r.frequencies, b)
 		if rank < rarest2 {
 			rarest1 = b
 			rarest2 = rank
 		}
+	}
 
-		if !found {
-			r.addRareByte(rarest1)
-		}
+	if !found {
+		r.addRareByte(rarest1)
 	}
 }
 
+// addRareByte adds `b` to the set of rare bytes.
+// With ascii case insensitivity, both cases of a letter take up a single slot, since the scan folds them
 func (r *rareBytesBuilder) addRareByte(b byte) {
-	r.addOneRareByte(b)
+	if r.rareSet.insert(r.fold(b)) {
+		r.count += 1
+		r.rankSum += r.rank(b)
+	}
+}
+
+func (r *rareBytesBuilder) fold(b byte) byte {
 	if r.asciiCaseInsensitive {
-		r.addOneRareByte(oppositeAsciiCase(b))
+		return asciiFold(b)
 	}
+	return b
 }
 
-func (r *rareBytesBuilder) addOneRareByte(b byte) {
-	if r.rareSet.insert(b) {
-		r.count += 1
-		r.rankSum += uint16(freqRank(b))
+func (r *rareBytesBuilder) rank(b byte) uint16 {
+	if r.asciiCaseInsensitive && oppositeAsciiCase(b) != b {
+		return uint16(freqRank(r.frequencies, b)) + uint16(freqRank(r.frequencies, oppositeAsciiCase(b)))
 	}
+	return uint16(freqRank(r.frequencies, b))
 }
 
 func newRareByteOffset(i int) rareByteOffset {
@@ -435,9 +506,10 @@ func (r *rareBytesBuilder) setOffset(pos int, b byte) {
 	}
 }
 
-func newRareBytesBuilder(asciiCaseInsensitive bool) rareBytesBuilder {
+func newRareBytesBuilder(asciiCaseInsensitive bool, frequencies *[256]byte) rareBytesBuilder {
 	return rareBytesBuilder{
 		asciiCaseInsensitive: asciiCaseInsensitive,
+		frequencies:          frequencies,
 		rareSet:              byteSet{},
 		byteOffsets:          rareByteOffsets{},
 		available:            true,
@@ -448,6 +520,7 @@ func newRareBytesBuilder(asciiCaseInsensitive bool) rareBytesBuilder {
 
 type startBytesBuilder struct {
 	asciiCaseInsensitive bool
+	frequencies          *[256]byte
 	byteset              []bool
 	count                int
 	rankSum              uint16
@@ -461,10 +534,11 @@ func (s *startBytesBuilder) build() prefilter {
 	bytes := [3]byte{}
 
 	for b := 0; b < 256; b++ {
-		//todo case insensitive is not set in byteset
 		if !s.byteset[b] {
 			continue
 		}
+		// non ascii bytes are mostly UTF-8 lead bytes, which are common in non english text.
+		// They are left to the byte set, which only takes them if they are rare
 		if b > 0x7F {
 			return nil
 		}
@@ -476,17 +550,22 @@ func (s *startBytesBuilder) build() prefilter {
 	case 0:
 		return nil
 	case 1:
-		return &startBytesOne{byte1: bytes[0]}
+		return &startBytesOne{
+			byte1: bytes[0],
+			fold:  s.asciiCaseInsensitive,
+		}
 	case 2:
 		return &startBytesTwo{
 			byte1: bytes[0],
 			byte2: bytes[1],
+			fold:  s.asciiCaseInsensitive,
 		}
 	case 3:
 		return &startBytesThree{
 			byte1: bytes[0],
 			byte2: bytes[1],
 			byte3: bytes[2],
+			fold:  s.asciiCaseInsensitive,
 		}
 	default:
 		return nil
@@ -494,33 +573,39 @@ func (s *startBytesBuilder) build() prefilter {
 }
 
 func (s *startBytesBuilder) add(bytes []byte) {
-	if s.count > 3 || len(bytes) == 0 {
+	if s.count > byteSetMaxBytes || len(bytes) == 0 {
 		return
 	}
 
-	b := bytes[0]
+	s.addOneByte(bytes[0])
+}
 
-	s.addOneByte(b)
+// addOneByte adds `b` to the set of start bytes.
+// With ascii case insensitivity, both cases of a letter take up a single slot, since the scan folds them
+func (s *startBytesBuilder) addOneByte(b byte) {
+	rank := uint16(freqRank(s.frequencies, b))
 	if s.asciiCaseInsensitive {
-		s.addOneByte(oppositeAsciiCase(b))
+		if o := oppositeAsciiCase(b); o != b {
+			rank += uint16(freqRank(s.frequencies, o))
+		}
+		b = asciiFold(b)
 	}
-}
 
-func (s *startBytesBuilder) addOneByte(b byte) {
 	if !s.byteset[int(b)] {
 		s.byteset[int(b)] = true
 		s.count += 1
-		s.rankSum += uint16(freqRank(b))
+		s.rankSum += rank
 	}
 }
 
-func freqRank(b byte) byte {
-	return byteFrequencies[int(b)]
+func freqRank(frequencies *[256]byte, b byte) byte {
+	return frequencies[int(b)]
 }
 
-func newStartBytesBuilder(asciiCaseInsensitive bool) startBytesBuilder {
+func newStartBytesBuilder(asciiCaseInsensitive bool, frequencies *[256]byte) startBytesBuilder {
 	return startBytesBuilder{
 		asciiCaseInsensitive: asciiCaseInsensitive,
+		frequencies:          frequencies,
 		byteset:              make([]bool, 256),
 		count:                0,
 		rankSum:              0,
@@ -530,12 +615,62 @@ func newStartBytesBuilder(asciiCaseInsensitive bool) startBytesBuilder {
 const minSkips int = 40
 const minAvgFactor int = 2
 
+type prefilterMode int
+
+const (
+	// PrefilterAuto uses the prefilter until it stops being effective.
+	// It is disabled for the rest of the search once it has reported at least `minSkips` candidates
+	// and skipped on average less than `minAvgFactor` times the longest pattern per candidate.
+	PrefilterAuto prefilterMode = iota
+	// PrefilterAlways uses the prefilter for the whole search, regardless of how effective it is.
+	PrefilterAlways
+	// PrefilterNever does not build a prefilter at all.
+	PrefilterNever
+)
+
+// PrefilterStats describes how the prefilter behaved during a single search
+type PrefilterStats struct {
+	// Candidates is the number of candidate positions reported by the prefilter
+	Candidates int
+	// Skipped is the total number of haystack bytes the prefilter skipped over
+	Skipped int
+	// Inert is true if the prefilter was disabled because it was not effective
+	Inert bool
+	// InertAt is the haystack offset at which the prefilter was disabled or -1 if it never was
+	InertAt int
+}
+
 type prefilterState struct {
 	skips       int
 	skipped     int
+	candidates  int
 	maxMatchLen int
 	inert       bool
+	inertAt     int
 	lastScanAt  int
+	mode        prefilterMode
+}
+
+func newPrefilterState(maxMatchLen int, mode prefilterMode) prefilterState {
+	return prefilterState{
+		skips:       0,
+		skipped:     0,
+		candidates:  0,
+		maxMatchLen: maxMatchLen,
+		inert:       false,
+		inertAt:     -1,
+		lastScanAt:  0,
+		mode:        mode,
+	}
+}
+
+func (p *prefilterState) stats() PrefilterStats {
+	return PrefilterStats{
+		Candidates: p.candidates,
+		Skipped:    p.skipped,
+		Inert:      p.inert,
+		InertAt:    p.inertAt,
+	}
 }
 
 func (p *prefilterState) updateAt(at int) {
@@ -549,7 +684,7 @@ func (p *prefilterState) IsEffective(at int) bool {
 		return false
 	}
 
-	if p.skips < minSkips {
+	if p.mode == PrefilterAlways || p.skips < minSkips {
 		return true
 	}
 
@@ -560,6 +695,7 @@ func (p *prefilterState) IsEffective(at int) bool {
 	}
 
 	p.inert = true
+	p.inertAt = at
 	return false
 }
 
@@ -583,6 +719,7 @@ func nextPrefilter(state *prefilterState, prefilter prefilter, haystack []byte,
 	if cand < 0 {
 		state.updateSkippedBytes(len(haystack) - at)
 	} else {
+		state.candidates += 1
 		state.updateSkippedBytes(cand - at)
 	}
 	return cand
@@ -0,0 +1,170 @@
+package aho_corasick
+
+// Rabin-Karp is used instead of the automaton for small sets of patterns which don't get a prefilter.
+// It computes a rolling hash of a window as long as the shortest pattern and only compares the patterns
+// whose prefix of that length hashes to the same value.
+const (
+	rabinKarpMaxPatterns   = 16
+	rabinKarpMinPatternLen = 2
+	rabinKarpMaxPatternLen = 64
+	rabinKarpBuckets       = 64
+)
+
+type rabinKarpEntry struct {
+	hash    uint
+	pattern int
+}
+
+// rabinKarp wraps an automaton and takes over its non overlapping searches.
+// Overlapping searches still walk the automaton.
+type rabinKarp struct {
+	imp
+	patterns             [][]byte
+	buckets              [rabinKarpBuckets][]rabinKarpEntry
+	hashLen              int
+	hash2Pow             uint
+	asciiCaseInsensitive bool
+}
+
+// useRabinKarp decides whether the patterns are better searched with Rabin-Karp than with the automaton.
+// That is the case if there is no prefilter or only the portable Teddy, which is slower than Rabin-Karp.
+// A window shorter than rabinKarpMinPatternLen hits too often and long patterns make every hit expensive to verify
+func useRabinKarp(i imp, patterns [][]byte) bool {
+	if len(patterns) == 0 || len(patterns) > rabinKarpMaxPatterns {
+		return false
+	}
+
+	if p := i.Prefilter(); p != nil {
+		if _, packed := p.(*teddy); !packed || teddyVector {
+			return false
+		}
+	}
+
+	for _, p := range patterns {
+		if len(p) < rabinKarpMinPatternLen || len(p) > rabinKarpMaxPatternLen {
+			return false
+		}
+	}
+	return true
+}
+
+func newRabinKarp(i imp, patterns [][]byte, asciiCaseInsensitive bool) *rabinKarp {
+	rk := rabinKarp{
+		imp:                  i,
+		patterns:             make([][]byte, len(patterns)),
+		hashLen:              len(patterns[0]),
+		hash2Pow:             1,
+		asciiCaseInsensitive: asciiCaseInsensitive,
+	}
+
+	for pi, p := range patterns {
+		rk.patterns[pi] = append([]byte(nil), p...)
+		if len(p) < rk.hashLen {
+			rk.hashLen = len(p)
+		}
+	}
+
+	for i := 1; i < rk.hashLen; i++ {
+		rk.hash2Pow <<= 1
+	}
+
+	for pi, p := range rk.patterns {
+		hash := rk.hash(p[:rk.hashLen])
+		bucket := hash % rabinKarpBuckets
+		rk.buckets[bucket] = append(rk.buckets[bucket], rabinKarpEntry{hash: hash, pattern: pi})
+	}
+
+	return &rk
+}
+
+func (r *rabinKarp) fold(b byte) byte {
+	if r.asciiCaseInsensitive {
+		return asciiFold(b)
+	}
+	return b
+}
+
+func (r *rabinKarp) hash(bytes []byte) uint {
+	var hash uint
+	for _, b := range bytes {
+		hash = r.updateHash(hash, b)
+	}
+	return hash
+}
+
+func (r *rabinKarp) updateHash(hash uint, b byte) uint {
+	return (hash << 1) + uint(r.fold(b))
+}
+
+func (r *rabinKarp) rollHash(hash uint, old, new byte) uint {
+	return r.updateHash(hash-uint(r.fold(old))*r.hash2Pow, new)
+}
+
+func (r *rabinKarp) matchesAt(haystack []byte, at int, pattern []byte) bool {
+	if len(haystack)-at < len(pattern) {
+		return false
+	}
+
+	for i, b := range pattern {
+		if r.fold(haystack[at+i]) != r.fold(b) {
+			return false
+		}
+	}
+	return true
+}
+
+// FindAtNoState gives the same match the automaton would, for every match kind
+func (r *rabinKarp) FindAtNoState(_ *prefilterState, haystack []byte, at int) (Match, bool) {
+	if len(haystack)-at < r.hashLen {
+		return Match{}, false
+	}
+
+	kind := *r.MatchKind()
+	var best Match
+	found := false
+	hash := r.hash(haystack[at : at+r.hashLen])
+
+	for {
+		if found && at+r.hashLen > best.end {
+			return best, true
+		}
+
+		for _, entry := range r.buckets[hash%rabinKarpBuckets] {
+			if entry.hash != hash || !r.matchesAt(haystack, at, r.patterns[entry.pattern]) {
+				continue
+			}
+			m := Match{
+				pattern: entry.pattern,
+				len:     len(r.patterns[entry.pattern]),
+				end:     at + len(r.patterns[entry.pattern]),
+			}
+			if !found || r.isBetter(kind, m, best) {
+				best, found = m, true
+			}
+		}
+
+		if found && kind.isLeftmost() {
+			return best, true
+		}
+
+		if at+r.hashLen >= len(haystack) {
+			return best, found
+		}
+		hash = r.rollHash(hash, haystack[at], haystack[at+r.hashLen])
+		at += 1
+	}
+}
+
+// isBetter reports whether `m` should be reported instead of `best`.
+// Leftmost kinds only compare matches that start at the same position,
+// standard matches are reported as soon as they end and the longer one wins if they end at the same position.
+func (r *rabinKarp) isBetter(kind matchKind, m, best Match) bool {
+	switch kind {
+	case LeftMostFirstMatch:
+		return m.pattern < best.pattern
+	case LeftMostLongestMatch:
+		return m.len > best.len || (m.len == best.len && m.pattern < best.pattern)
+	default:
+		return m.end < best.end || (m.end == best.end && (m.len > best.len || (m.len == best.len && m.pattern < best.pattern)))
+	}
+}
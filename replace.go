@@ -0,0 +1,388 @@
+package aho_corasick
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ConflictPolicy decides which matches a Replacer replaces, when they overlap.
+// Except for ConflictAsFound, the policies choose from every occurrence of every pattern,
+// so they give the same result for every MatchKind. An AhoCorasick with a leftmost match kind needs Opts.Overlapping for them,
+// finders other than AhoCorasick offer what their FindAll returns.
+//
+// The patterns "abcd" and "bc" replaced by "1" and "2" in "xabcdx" give
+//
+//	ConflictAsFound          "xa2dx" for StandardMatch, "x1x" for the leftmost match kinds
+//	ConflictLeftmostLongest  "x1x"
+//	ConflictFirstWins        "xa2dx"
+//	ConflictError            *OverlapError
+type ConflictPolicy int
+
+const (
+	// ConflictAsFound replaces the matches the way the finder reports them, continuing after the end of every replaced one.
+	// Matches of FindAll that start inside a replaced one are skipped. This is the default and needs no more than a single search
+	ConflictAsFound ConflictPolicy = iota
+	// ConflictLeftmostLongest replaces the candidate that starts first, the longest one among those starting at the same position,
+	// and then continues after its end
+	ConflictLeftmostLongest
+	// ConflictFirstWins replaces the candidate that ends first, the longest one among those ending at the same position,
+	// and skips the candidates that overlap one that was replaced already
+	ConflictFirstWins
+	// ConflictError replaces nothing and gives an *OverlapError, if any two candidates overlap.
+	// An empty match overlaps a match that starts at, or contains its position
+	ConflictError
+)
+
+// OverlapError is returned by a Replacer with the ConflictError policy for the first two overlapping matches
+type OverlapError struct {
+	First, Second Match
+}
+
+func (e *OverlapError) Error() string {
+	return fmt.Sprintf("match of pattern %d at [%d:%d] overlaps match of pattern %d at [%d:%d]",
+		e.Second.pattern, e.Second.Start(), e.Second.End(), e.First.pattern, e.First.Start(), e.First.End())
+}
+
+// PreserveCase gives a copy of the Replacer, which gives the replacements of ReplaceAll, ReplaceAllBytes and AppendReplace
+// the case of the text they replace. It is meant for finders, which match case insensitively.
+// The letters of the matched text decide the case
+//
+//	lower  "colour" -> "color"  every letter in lower case
+//	upper  "COLOUR" -> "COLOR"  every letter in upper case, if there are at least two
+//	title  "Colour" -> "Color"  the first letter in upper case, the rest in lower case
+//	mixed  "cOLour" -> "cOLor"  the case of the letter at the same position, the last one past the end of the match
+//
+// Only ASCII letters change their case, the replacement is used as it is if the matched text has none
+func (r Replacer) PreserveCase() Replacer {
+	r.preserveCase = true
+	return r
+}
+
+// ReplaceAllFuncBytes replaces the matches found in the haystack according to the user provided function, like ReplaceAllFunc.
+// If nothing is replaced, the haystack itself is returned.
+// It panics with an *OverlapError, if the policy is ConflictError and matches overlap
+func (r Replacer) ReplaceAllFuncBytes(haystack []byte, f func(match Match) ([]byte, bool)) []byte {
+	replaced, err := r.ReplaceAllFuncBytesChecked(haystack, f)
+	if err != nil {
+		panic(err)
+	}
+	return replaced
+}
+
+// ReplaceAllFuncBytesChecked is ReplaceAllFuncBytes, which returns an *OverlapError instead of panicking.
+// The haystack is returned unchanged with the error
+func (r Replacer) ReplaceAllFuncBytesChecked(haystack []byte, f func(match Match) ([]byte, bool)) ([]byte, error) {
+	replaced := false
+	dst, err := r.appendReplace(nil, haystack, func(match Match) ([]byte, bool) {
+		rw, ok := f(match)
+		replaced = replaced || ok
+		return rw, ok
+	})
+
+	if err != nil || !replaced {
+		return haystack, err
+	}
+	return dst, nil
+}
+
+// ReplaceAllBytes replaces the matches found in the haystack according to the user provided slice `replaceWith`, like ReplaceAll.
+// It panics, if `replaceWith` has length different from the patterns that it was built with, or like ReplaceAllFuncBytes
+func (r Replacer) ReplaceAllBytes(haystack []byte, replaceWith [][]byte) []byte {
+	replaced, err := r.ReplaceAllBytesChecked(haystack, replaceWith)
+	if err != nil {
+		panic(err)
+	}
+	return replaced
+}
+
+// ReplaceAllBytesChecked is ReplaceAllBytes, which returns an *OverlapError instead of panicking, if the policy is ConflictError and matches overlap.
+// It panics, if `replaceWith` has length different from the patterns that it was built with
+func (r Replacer) ReplaceAllBytesChecked(haystack []byte, replaceWith [][]byte) ([]byte, error) {
+	if len(replaceWith) != r.finder.PatternCount() {
+		panic("replaceWith needs to have the same length as the pattern count")
+	}
+
+	var buf []byte
+	return r.ReplaceAllFuncBytesChecked(haystack, func(match Match) ([]byte, bool) {
+		if r.preserveCase {
+			buf = applyCase(buf[:0], haystack[match.Start():match.End()], replaceWith[match.pattern])
+			return buf, true
+		}
+		return replaceWith[match.pattern], true
+	})
+}
+
+// AppendReplace appends `src` with the matches replaced according to `replaceWith` to `dst` and gives the extended slice.
+// `dst` must not overlap with `src`.
+// It panics, if `replaceWith` has length different from the patterns that it was built with, or like ReplaceAllFuncBytes
+func (r Replacer) AppendReplace(dst, src []byte, replaceWith [][]byte) []byte {
+	dst, err := r.AppendReplaceChecked(dst, src, replaceWith)
+	if err != nil {
+		panic(err)
+	}
+	return dst
+}
+
+// AppendReplaceChecked is AppendReplace, which returns an *OverlapError instead of panicking, if the policy is ConflictError and matches overlap.
+// `dst` is returned unchanged with the error
+func (r Replacer) AppendReplaceChecked(dst, src []byte, replaceWith [][]byte) ([]byte, error) {
+	if len(replaceWith) != r.finder.PatternCount() {
+		panic("replaceWith needs to have the same length as the pattern count")
+	}
+
+	var buf []byte
+	return r.appendReplace(dst, src, func(match Match) ([]byte, bool) {
+		if r.preserveCase {
+			buf = applyCase(buf[:0], src[match.Start():match.End()], replaceWith[match.pattern])
+			return buf, true
+		}
+		return replaceWith[match.pattern], true
+	})
+}
+
+// appendReplace appends `src` to `dst`, with the matches replaced by what `f` gives, until it returns false
+func (r Replacer) appendReplace(dst, src []byte, f func(match Match) ([]byte, bool)) ([]byte, error) {
+	start := 0
+	replace := func(match Match) bool {
+		if match.Start() < start {
+			return true
+		}
+		rw, ok := f(match)
+		if !ok {
+			return false
+		}
+		dst = append(dst, src[start:match.Start()]...)
+		dst = append(dst, rw...)
+		start = match.End()
+		return true
+	}
+
+	if r.policy == ConflictAsFound {
+		r.eachMatch(src, replace)
+		return append(dst, src[start:]...), nil
+	}
+
+	matches, err := resolveConflicts(r.policy, r.candidates(src))
+	if err != nil {
+		return dst, err
+	}
+	for _, match := range matches {
+		if !replace(match) {
+			break
+		}
+	}
+	return append(dst, src[start:]...), nil
+}
+
+// replacements gives the matches to replace in the haystack, ordered and without overlaps
+func (r Replacer) replacements(haystack string) ([]Match, error) {
+	if r.policy != ConflictAsFound {
+		return resolveConflicts(r.policy, r.candidates([]byte(haystack)))
+	}
+
+	matches := r.finder.FindAll(haystack)
+	end, kept := 0, 0
+	for _, match := range matches {
+		if match.Start() < end {
+			continue
+		}
+		matches[kept] = match
+		kept += 1
+		end = match.End()
+	}
+	return matches[:kept], nil
+}
+
+// candidates gives the matches a policy chooses from.
+// For an AhoCorasick finder, those are all overlapping matches, ordered by their end
+func (r Replacer) candidates(haystack []byte) []Match {
+	ac, ok := automatonOf(r.finder)
+	if !ok {
+		return r.finder.FindAll(string(haystack))
+	}
+
+	ac = ac.overlapping()
+	prestate := ac.newPrefilterState()
+	iter := newOverlappingIter(ac, &prestate, haystack)
+	matches := make([]Match, 0)
+	for m, ok := iter.next(); ok; m, ok = iter.next() {
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+// automatonOf gives the AhoCorasick behind `finder`, if it is one
+func automatonOf(finder Finder) (AhoCorasick, bool) {
+	switch finder := finder.(type) {
+	case AhoCorasick:
+		return finder, true
+	case *AhoCorasick:
+		return *finder, true
+	}
+	return AhoCorasick{}, false
+}
+
+// resolveConflicts keeps the matches the policy replaces, in place
+func resolveConflicts(policy ConflictPolicy, matches []Match) ([]Match, error) {
+	if policy == ConflictLeftmostLongest || policy == ConflictError {
+		sort.SliceStable(matches, func(i, j int) bool {
+			if matches[i].Start() != matches[j].Start() {
+				return matches[i].Start() < matches[j].Start()
+			}
+			return matches[i].len > matches[j].len
+		})
+	} else {
+		sort.SliceStable(matches, func(i, j int) bool {
+			if matches[i].End() != matches[j].End() {
+				return matches[i].End() < matches[j].End()
+			}
+			return matches[i].len > matches[j].len
+		})
+	}
+
+	kept := 0
+	for _, match := range matches {
+		if kept > 0 {
+			last := matches[kept-1]
+			if match.Start() < last.End() || match.Start() == last.Start() {
+				if policy == ConflictError {
+					return nil, &OverlapError{First: last, Second: match}
+				}
+				continue
+			}
+		}
+		matches[kept] = match
+		kept += 1
+	}
+	return matches[:kept], nil
+}
+
+// eachMatch calls `fn` with the matches found in the haystack, until it returns false.
+// An AhoCorasick finder is searched directly, continuing after the end of every match.
+// Other finders are asked for all of their matches
+func (r Replacer) eachMatch(haystack []byte, fn func(match Match) bool) {
+	var ac AhoCorasick
+	switch finder := r.finder.(type) {
+	case AhoCorasick:
+		ac = finder
+	case *AhoCorasick:
+		ac = *finder
+	default:
+		for _, match := range r.finder.FindAll(string(haystack)) {
+			if !fn(match) {
+				return
+			}
+		}
+		return
+	}
+
+	prestate := prestatePool.Get().(*prefilterState)
+	defer prestatePool.Put(prestate)
+	*prestate = ac.newPrefilterState()
+
+	for pos := 0; pos <= len(haystack); {
+		match, ok := ac.i.FindAtNoState(prestate, haystack, pos)
+		if !ok {
+			return
+		}
+
+		if ac.matchOnlyWholeWords && !isWholeWord(haystack, match) {
+			pos = match.Start() + 1
+			continue
+		}
+		if !fn(match) {
+			return
+		}
+
+		pos = match.End()
+		if match.len == 0 {
+			pos += 1
+		}
+	}
+}
+
+type caseShape int
+
+const (
+	caseNone caseShape = iota
+	caseLower
+	caseUpper
+	caseTitle
+	caseMixed
+)
+
+// shapeOf tells the case of the ASCII letters in `s`
+func shapeOf(s []byte) caseShape {
+	letters, upper := 0, 0
+	firstUpper := false
+	for i := 0; i < len(s); i++ {
+		if !isASCIILetter(s[i]) {
+			continue
+		}
+		isUpper := s[i] >= 'A' && s[i] <= 'Z'
+		if isUpper {
+			upper += 1
+		}
+		if letters == 0 {
+			firstUpper = isUpper
+		}
+		letters += 1
+	}
+
+	switch {
+	case letters == 0:
+		return caseNone
+	case upper == 0:
+		return caseLower
+	case upper == letters && letters > 1:
+		return caseUpper
+	case upper == 1 && firstUpper:
+		return caseTitle
+	default:
+		return caseMixed
+	}
+}
+
+// applyCase appends `replacement` to `dst`, with its ASCII letters in the case of `matched`
+func applyCase(dst, matched, replacement []byte) []byte {
+	shape := shapeOf(matched)
+	start := len(dst)
+	dst = append(dst, replacement...)
+	if shape == caseNone {
+		return dst
+	}
+
+	lastUpper := false
+	firstLetter := true
+	for i := start; i < len(dst); i++ {
+		var upper bool
+		switch shape {
+		case caseLower:
+			upper = false
+		case caseUpper:
+			upper = true
+		case caseTitle:
+			upper = firstLetter
+		case caseMixed:
+			if j := i - start; j < len(matched) && isASCIILetter(matched[j]) {
+				lastUpper = matched[j] >= 'A' && matched[j] <= 'Z'
+			}
+			upper = lastUpper
+		}
+
+		if !isASCIILetter(dst[i]) {
+			continue
+		}
+		firstLetter = false
+		if upper {
+			dst[i] &^= 0x20
+		} else {
+			dst[i] |= 0x20
+		}
+	}
+	return dst
+}
+
+func isASCIILetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
@@ -0,0 +1,101 @@
+package aho_corasick
+
+import (
+	"sort"
+	"unicode/utf8"
+)
+
+// Snippet is a window of the haystack around one or more matches
+type Snippet struct {
+	Start   int
+	End     int
+	Matches []Match
+}
+
+// Snippets gives a window of the haystack around every match, `before` bytes before its start and `after` bytes after its end.
+// A window that would cut a word is shrunk to the word boundary, the same MatchOnlyWholeWords uses,
+// unless that leaves nothing around the match. The bytes of multi-byte UTF-8 sequences count as part of a word,
+// and windows never cut such a sequence.
+// Windows that overlap or touch are merged, so the snippets are ordered and disjoint.
+// It panics, if `before` or `after` is negative
+func Snippets(haystack []byte, matches []Match, before, after int) []Snippet {
+	if before < 0 || after < 0 {
+		panic("before and after need to be at least 0")
+	}
+
+	sorted := make([]Match, len(matches))
+	copy(sorted, matches)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Start() < sorted[j].Start()
+	})
+
+	snippets := make([]Snippet, 0)
+	for _, m := range sorted {
+		// the windows are clamped to the haystack first, so large ones don't overflow
+		left, right := before, after
+		if left > m.Start() {
+			left = m.Start()
+		}
+		if right > len(haystack)-m.End() {
+			right = len(haystack) - m.End()
+		}
+		start := snapStart(haystack, m.Start()-left, m.Start())
+		end := snapEnd(haystack, m.End()+right, m.End())
+
+		if n := len(snippets); n > 0 && start <= snippets[n-1].End {
+			last := &snippets[n-1]
+			if end > last.End {
+				last.End = end
+			}
+			last.Matches = append(last.Matches, m)
+			continue
+		}
+		snippets = append(snippets, Snippet{Start: start, End: end, Matches: []Match{m}})
+	}
+	return snippets
+}
+
+// snapStart moves the start of a window forward, out of the word it cuts, but not past `limit`
+func snapStart(haystack []byte, start, limit int) int {
+	if start <= 0 {
+		return 0
+	}
+
+	snapped := start
+	for snapped < limit && isSnippetWordByte(haystack[snapped-1]) && isSnippetWordByte(haystack[snapped]) {
+		snapped += 1
+	}
+	if snapped == limit && limit != start {
+		snapped = start
+	}
+
+	for snapped < limit && !utf8.RuneStart(haystack[snapped]) {
+		snapped += 1
+	}
+	return snapped
+}
+
+// snapEnd moves the end of a window back, out of the word it cuts, but not before `limit`
+func snapEnd(haystack []byte, end, limit int) int {
+	if end >= len(haystack) {
+		return len(haystack)
+	}
+
+	snapped := end
+	for snapped > limit && isSnippetWordByte(haystack[snapped-1]) && isSnippetWordByte(haystack[snapped]) {
+		snapped -= 1
+	}
+	if snapped == limit && limit != end {
+		snapped = end
+	}
+
+	for snapped > limit && !utf8.RuneStart(haystack[snapped]) {
+		snapped -= 1
+	}
+	return snapped
+}
+
+// isSnippetWordByte is isWordByte, which also keeps multi-byte UTF-8 sequences together
+func isSnippetWordByte(b byte) bool {
+	return b >= utf8.RuneSelf || isWordByte(b)
+}
@@ -0,0 +1,87 @@
+package aho_corasick
+
+import (
+	"errors"
+	"hash/fnv"
+)
+
+// a pass of ReplaceUntilStable may not make the text longer than this many times the haystack, or stableMinLimit
+const (
+	stableGrowthFactor = 16
+	stableMinLimit     = 4096
+)
+
+var (
+	// ErrNotStable is returned by ReplaceUntilStable, if the text still changed in the last allowed pass
+	ErrNotStable = errors.New("replacements did not become stable")
+	// ErrReplaceCycle is returned by ReplaceUntilStable, if a pass gave a text an earlier pass gave already
+	ErrReplaceCycle = errors.New("replacements cycle")
+	// ErrReplaceGrowth is returned by ReplaceUntilStable, if the text grew past its limit
+	ErrReplaceGrowth = errors.New("replacements grow the text without bound")
+)
+
+// ReplaceUntilStable applies ReplaceAll to the haystack again and again, until a pass doesn't change it anymore.
+// It gives the stable text and the number of passes that ran, including the last one which changed nothing.
+// Before the text is stable, it stops with
+//
+//	ErrNotStable      after `maxPasses` passes
+//	ErrReplaceCycle   when a pass gives a text that an earlier pass gave, the replacements would repeat forever
+//	ErrReplaceGrowth  when the text becomes longer than 16 times the haystack, and at least 4096 bytes
+//
+// or with the error of ReplaceAllChecked. The text of the last pass is returned along with the error.
+// It panics, if `replaceWith` has length different from the patterns that it was built with
+func (r Replacer) ReplaceUntilStable(haystack string, replaceWith []string, maxPasses int) (string, int, error) {
+	return r.replaceUntilStable(haystack, replaceWith, maxPasses, textSum)
+}
+
+// replaceUntilStable is ReplaceUntilStable with the hash of the texts given by `sum`
+func (r Replacer) replaceUntilStable(haystack string, replaceWith []string, maxPasses int, sum func(string) uint64) (string, int, error) {
+	limit := stableGrowthFactor * len(haystack)
+	if limit < stableMinLimit {
+		limit = stableMinLimit
+	}
+
+	// only the hashes of the earlier texts are kept with the passes that gave them,
+	// on a hit the earlier text is replaced again from the haystack to compare it
+	seen := map[uint64][]int{sum(haystack): {0}}
+
+	text := haystack
+	for passes := 1; passes <= maxPasses; passes++ {
+		replaced, err := r.ReplaceAllChecked(text, replaceWith)
+		if err != nil {
+			return text, passes, err
+		}
+		if replaced == text {
+			return text, passes, nil
+		}
+		text = replaced
+
+		if len(text) > limit {
+			return text, passes, ErrReplaceGrowth
+		}
+
+		h := sum(text)
+		for _, earlier := range seen[h] {
+			if r.replacePasses(haystack, replaceWith, earlier) == text {
+				return text, passes, ErrReplaceCycle
+			}
+		}
+		seen[h] = append(seen[h], passes)
+	}
+	return text, maxPasses, ErrNotStable
+}
+
+// replacePasses gives the text ReplaceUntilStable had after `passes` passes, which all succeeded
+func (r Replacer) replacePasses(haystack string, replaceWith []string, passes int) string {
+	text := haystack
+	for i := 0; i < passes; i++ {
+		text, _ = r.ReplaceAllChecked(text, replaceWith)
+	}
+	return text
+}
+
+func textSum(text string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(text))
+	return h.Sum64()
+}
@@ -0,0 +1,210 @@
+package aho_corasick
+
+import (
+	"bytes"
+	"math/bits"
+)
+
+// Teddy is the packed multi substring search of Hyperscan. The patterns are put into 8 buckets
+// and positions where the first bytes of a bucket's patterns could start are verified against them.
+const (
+	teddyMaxPatterns    = 64
+	teddyMaxFingerprint = 3
+	teddyBuckets        = 8
+)
+
+type teddyBuilder struct {
+	asciiCaseInsensitive bool
+	available            bool
+	patterns             [][]byte
+}
+
+func newTeddyBuilder(asciiCaseInsensitive bool) teddyBuilder {
+	return teddyBuilder{
+		asciiCaseInsensitive: asciiCaseInsensitive,
+		available:            true,
+		patterns:             nil,
+	}
+}
+
+func (t *teddyBuilder) add(bytes []byte) {
+	if !t.available {
+		return
+	}
+
+	if len(bytes) == 0 || len(t.patterns) >= teddyMaxPatterns {
+		t.available = false
+		t.patterns = nil
+		return
+	}
+
+	t.patterns = append(t.patterns, append([]byte(nil), bytes...))
+}
+
+func (t *teddyBuilder) build() prefilter {
+	if !t.available || len(t.patterns) == 0 {
+		return nil
+	}
+
+	minLen := len(t.patterns[0])
+	for _, p := range t.patterns {
+		if len(p) < minLen {
+			minLen = len(p)
+		}
+	}
+
+	fingerprintLen := teddyMaxFingerprint
+	if minLen < fingerprintLen {
+		fingerprintLen = minLen
+	}
+
+	td := teddy{
+		patterns:             t.patterns,
+		minLen:               minLen,
+		fingerprintLen:       fingerprintLen,
+		asciiCaseInsensitive: t.asciiCaseInsensitive,
+	}
+
+	// offsets past the fingerprint accept every bucket, so the vectorized scan can always look at all of them
+	for k := fingerprintLen; k < teddyMaxFingerprint; k++ {
+		for i := range td.nibbles[k].lo {
+			td.nibbles[k].lo[i] = 0xFF
+			td.nibbles[k].hi[i] = 0xFF
+		}
+	}
+
+	// patterns sharing a fingerprint go into the same bucket, so they don't pollute the others
+	bucketOf := make(map[string]int)
+	for pi, p := range t.patterns {
+		fingerprint := append([]byte(nil), p[:fingerprintLen]...)
+		if t.asciiCaseInsensitive {
+			for k, b := range fingerprint {
+				fingerprint[k] = asciiFold(b)
+			}
+		}
+		bucket, ok := bucketOf[string(fingerprint)]
+		if !ok {
+			bucket = len(bucketOf) % teddyBuckets
+			bucketOf[string(fingerprint)] = bucket
+		}
+		td.buckets[bucket] = append(td.buckets[bucket], pi)
+		td.add(bucket, fingerprint)
+		if t.asciiCaseInsensitive {
+			for k, b := range fingerprint {
+				fingerprint[k] = oppositeAsciiCase(b)
+			}
+			td.add(bucket, fingerprint)
+		}
+	}
+
+	return &td
+}
+
+// teddyNibbles are the bucket tables of a fingerprint byte, split by its low and high nibble.
+// This is the form the vectorized scan needs, it can only do 16 entry table lookups.
+type teddyNibbles struct {
+	lo [16]byte
+	hi [16]byte
+}
+
+type teddy struct {
+	patterns             [][]byte
+	buckets              [teddyBuckets][]int
+	masks                [teddyMaxFingerprint][256]byte
+	nibbles              [teddyMaxFingerprint]teddyNibbles
+	fingerprintLen       int
+	minLen               int
+	asciiCaseInsensitive bool
+}
+
+// add puts the bytes of a fingerprint into the tables of the bucket
+func (t *teddy) add(bucket int, fingerprint []byte) {
+	for k, b := range fingerprint {
+		t.masks[k][b] |= 1 << uint(bucket)
+		t.nibbles[k].lo[b&0xF] |= 1 << uint(bucket)
+		t.nibbles[k].hi[b>>4] |= 1 << uint(bucket)
+	}
+}
+
+func (t *teddy) NextCandidate(_ *prefilterState, haystack []byte, at int) int {
+	last := len(haystack) - t.minLen
+
+	for at <= last {
+		stop := last + 1
+		if teddyVector {
+			at += teddyScanVector(&t.nibbles, haystack[at:], stop-at)
+			if at+16 < stop {
+				stop = at + 16
+			}
+		}
+
+		for ; at < stop; at++ {
+			if t.verify(haystack, at) {
+				return at
+			}
+		}
+	}
+	return noneCandidate
+}
+
+func (t *teddy) verify(haystack []byte, at int) bool {
+	set := t.masks[0][haystack[at]]
+	for k := 1; k < t.fingerprintLen && set != 0; k++ {
+		set &= t.masks[k][haystack[at+k]]
+	}
+
+	for set != 0 {
+		bucket := bits.TrailingZeros8(set)
+		set &= set - 1
+
+		for _, pi := range t.buckets[bucket] {
+			if t.hasPrefix(haystack[at:], t.patterns[pi]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (t *teddy) hasPrefix(haystack []byte, pattern []byte) bool {
+	if !t.asciiCaseInsensitive {
+		return bytes.HasPrefix(haystack, pattern)
+	}
+
+	if len(haystack) < len(pattern) {
+		return false
+	}
+	for i, b := range pattern {
+		if asciiFold(haystack[i]) != asciiFold(b) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *teddy) HeapBytes() int {
+	var size int
+	for _, p := range t.patterns {
+		size += len(p)
+	}
+	for _, b := range t.buckets {
+		size += len(b) * 8
+	}
+	return size
+}
+
+func (t *teddy) ReportsFalsePositives() bool {
+	return false
+}
+
+func (t *teddy) LooksForNonStartOfMatch() bool {
+	return false
+}
+
+func (t *teddy) clone() prefilter {
+	if t == nil {
+		return nil
+	}
+	u := *t
+	return &u
+}
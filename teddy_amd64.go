@@ -0,0 +1,15 @@
+//go:build amd64 && !purego
+// +build amd64,!purego
+
+package aho_corasick
+
+// teddyVector reports whether the SSSE3 scan can be used
+var teddyVector = hasSSSE3()
+
+func hasSSSE3() bool
+
+// teddyScanVector gives the offset of the first block of 16 positions before `n` with a possible candidate,
+// or the offset of the first position that is not part of a whole block
+//
+//go:noescape
+func teddyScanVector(nibbles *[teddyMaxFingerprint]teddyNibbles, haystack []byte, n int) int
@@ -0,0 +1,76 @@
+//go:build amd64 && !purego
+// +build amd64,!purego
+
+#include "textflag.h"
+
+// func hasSSSE3() bool
+TEXT ·hasSSSE3(SB), NOSPLIT, $0-1
+	MOVL $1, AX
+	XORL CX, CX
+	CPUID
+	SHRL $9, CX
+	ANDL $1, CX
+	MOVB CX, ret+0(FP)
+	RET
+
+// TEDDY_LOOKUP ands the buckets of the 16 bytes at `off` into X6, using the nibble tables `lo` and `hi`
+#define TEDDY_LOOKUP(off, lo, hi) \
+	MOVOU  off(SI)(DI*1), X4 \
+	MOVOU  X4, X5            \
+	PAND   X2, X4            \
+	PSRLW  $4, X5            \
+	PAND   X2, X5            \
+	MOVOU  lo, X7            \
+	PSHUFB X4, X7            \
+	PAND   X7, X6            \
+	MOVOU  hi, X7            \
+	PSHUFB X5, X7            \
+	PAND   X7, X6
+
+// func teddyScanVector(nibbles *[teddyMaxFingerprint]teddyNibbles, haystack []byte, n int) int
+TEXT ·teddyScanVector(SB), NOSPLIT, $0-48
+	MOVQ nibbles+0(FP), AX
+	MOVQ haystack_base+8(FP), SI
+	MOVQ haystack_len+16(FP), CX
+	MOVQ n+32(FP), BX
+
+	// every block reads 16 bytes at the offsets 0, 1 and 2
+	SUBQ    $2, CX
+	CMPQ    CX, BX
+	CMOVQLT CX, BX
+
+	MOVOU 0(AX), X8
+	MOVOU 16(AX), X9
+	MOVOU 32(AX), X10
+	MOVOU 48(AX), X11
+	MOVOU 64(AX), X12
+	MOVOU 80(AX), X13
+
+	MOVQ       $0x0F0F0F0F0F0F0F0F, DX
+	MOVQ       DX, X2
+	PUNPCKLQDQ X2, X2
+	PXOR       X3, X3
+
+	XORQ DI, DI
+
+loop:
+	LEAQ 16(DI), R8
+	CMPQ R8, BX
+	JGT  done
+
+	PCMPEQB X6, X6
+	TEDDY_LOOKUP(0, X8, X9)
+	TEDDY_LOOKUP(1, X10, X11)
+	TEDDY_LOOKUP(2, X12, X13)
+
+	PCMPEQB  X3, X6
+	PMOVMSKB X6, R9
+	CMPL     R9, $0xFFFF
+	JNE      done
+
+	MOVQ R8, DI
+	JMP  loop
+
+done:
+	MOVQ DI, ret+40(FP)
+	RET
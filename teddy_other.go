@@ -0,0 +1,11 @@
+//go:build !amd64 || purego
+// +build !amd64 purego
+
+package aho_corasick
+
+// teddyVector reports whether the SSSE3 scan can be used
+var teddyVector = false
+
+func teddyScanVector(_ *[teddyMaxFingerprint]teddyNibbles, _ []byte, _ int) int {
+	return 0
+}
@@ -0,0 +1,189 @@
+package aho_corasick
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type placeholder int
+
+const (
+	placeholderNone placeholder = iota
+	placeholderMatch
+	placeholderPattern
+	placeholderUpper
+	placeholderLower
+	placeholderTitle
+)
+
+var placeholders = map[string]placeholder{
+	"0":       placeholderMatch,
+	"pattern": placeholderPattern,
+	"upper":   placeholderUpper,
+	"lower":   placeholderLower,
+	"title":   placeholderTitle,
+}
+
+// templatePart is either literal text or a placeholder
+type templatePart struct {
+	literal     string
+	placeholder placeholder
+}
+
+// TemplateReplacer replaces matches by templates, which can refer to the matched text.
+// A template may contain the placeholders
+//
+//	$0 or ${0}   the matched text
+//	${pattern}   the index of the matched pattern
+//	${upper}     the matched text in upper case
+//	${lower}     the matched text in lower case
+//	${title}     the matched text with its first letter in upper case and the rest in lower case
+//	$$           a literal $
+type TemplateReplacer struct {
+	replacer  Replacer
+	templates [][]templatePart
+}
+
+// NewTemplateReplacer compiles a template for every pattern of the finder.
+// It returns an error for a template with an unknown placeholder or a lone $.
+// It panics, if `templates` has length different from the patterns that the finder was built with
+func NewTemplateReplacer(finder Finder, templates []string) (TemplateReplacer, error) {
+	if len(templates) != finder.PatternCount() {
+		panic("templates needs to have the same length as the pattern count")
+	}
+
+	compiled := make([][]templatePart, len(templates))
+	for i, template := range templates {
+		parts, err := compileTemplate(template)
+		if err != nil {
+			return TemplateReplacer{}, fmt.Errorf("template %d: %w", i, err)
+		}
+		compiled[i] = parts
+	}
+
+	return TemplateReplacer{replacer: NewReplacer(finder), templates: compiled}, nil
+}
+
+func compileTemplate(template string) ([]templatePart, error) {
+	parts := make([]templatePart, 0)
+	var literal strings.Builder
+
+	for i := 0; i < len(template); i++ {
+		if template[i] != '$' {
+			literal.WriteByte(template[i])
+			continue
+		}
+
+		rest := template[i+1:]
+		var name string
+		switch {
+		case strings.HasPrefix(rest, "$"):
+			literal.WriteByte('$')
+			i += 1
+			continue
+		case strings.HasPrefix(rest, "0"):
+			name = "0"
+			i += 1
+		case strings.HasPrefix(rest, "{"):
+			end := strings.IndexByte(rest, '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed placeholder at %d", i)
+			}
+			name = rest[1:end]
+			i += end + 1
+		default:
+			return nil, fmt.Errorf("lone $ at %d, use $$ for a literal one", i)
+		}
+
+		p, ok := placeholders[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown placeholder %q", name)
+		}
+		if literal.Len() > 0 {
+			parts = append(parts, templatePart{literal: literal.String()})
+			literal.Reset()
+		}
+		parts = append(parts, templatePart{placeholder: p})
+	}
+
+	if literal.Len() > 0 {
+		parts = append(parts, templatePart{literal: literal.String()})
+	}
+	return parts, nil
+}
+
+// ReplaceAll replaces the matches found in the haystack by their templates
+func (t TemplateReplacer) ReplaceAll(haystack string) string {
+	var buf []byte
+	return t.replacer.ReplaceAllFunc(haystack, func(match Match) (string, bool) {
+		buf = t.expand(buf[:0], haystack[match.Start():match.End()], match.pattern)
+		return string(buf), true
+	})
+}
+
+// ReplaceAllBytes replaces the matches found in the haystack by their templates.
+// If nothing is replaced, the haystack itself is returned
+func (t TemplateReplacer) ReplaceAllBytes(haystack []byte) []byte {
+	var buf []byte
+	return t.replacer.ReplaceAllFuncBytes(haystack, func(match Match) ([]byte, bool) {
+		buf = t.expand(buf[:0], string(haystack[match.Start():match.End()]), match.pattern)
+		return buf, true
+	})
+}
+
+// AppendReplace appends `src` with the matches replaced by their templates to `dst` and gives the extended slice.
+// `dst` must not overlap with `src`
+func (t TemplateReplacer) AppendReplace(dst, src []byte) []byte {
+	var buf []byte
+	// the replacer replaces the matches as found, which never fails
+	dst, _ = t.replacer.appendReplace(dst, src, func(match Match) ([]byte, bool) {
+		buf = t.expand(buf[:0], string(src[match.Start():match.End()]), match.pattern)
+		return buf, true
+	})
+	return dst
+}
+
+// expand appends the template of the pattern, filled in with the matched text, to `dst`
+func (t TemplateReplacer) expand(dst []byte, matched string, pattern int) []byte {
+	for _, part := range t.templates[pattern] {
+		switch part.placeholder {
+		case placeholderNone:
+			dst = append(dst, part.literal...)
+		case placeholderMatch:
+			dst = append(dst, matched...)
+		case placeholderPattern:
+			dst = strconv.AppendInt(dst, int64(pattern), 10)
+		case placeholderUpper:
+			dst = appendMapped(dst, matched, unicode.ToUpper)
+		case placeholderLower:
+			dst = appendMapped(dst, matched, unicode.ToLower)
+		case placeholderTitle:
+			_, size := utf8.DecodeRuneInString(matched)
+			dst = appendMapped(dst, matched[:size], unicode.ToUpper)
+			dst = appendMapped(dst, matched[size:], unicode.ToLower)
+		}
+	}
+	return dst
+}
+
+// appendMapped appends `s` to `dst` with every rune mapped by `f`, bytes that are not valid UTF-8 are kept as they are
+func appendMapped(dst []byte, s string, f func(rune) rune) []byte {
+	var encoded [utf8.UTFMax]byte
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			dst = append(dst, s[i])
+		case r < utf8.RuneSelf:
+			dst = append(dst, byte(f(r)))
+		default:
+			n := utf8.EncodeRune(encoded[:], f(r))
+			dst = append(dst, encoded[:n]...)
+		}
+		i += size
+	}
+	return dst
+}